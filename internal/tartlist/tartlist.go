@@ -0,0 +1,38 @@
+// Package tartlist parses the output of `tart list --format json`. The executor
+// and the provider's local mode both read it, so the quirks live in one place.
+package tartlist
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Entry mirrors one element of `tart list --format json`.
+type Entry struct {
+	Source   string `json:"Source"`
+	Name     string `json:"Name"`
+	Disk     int    `json:"Disk"`
+	Size     int    `json:"Size"`
+	Accessed string `json:"Accessed"`
+	State    string `json:"State"`
+	Running  bool   `json:"Running"`
+}
+
+// Parse decodes the JSON emitted by `tart list --format json`.
+func Parse(out []byte) ([]Entry, error) {
+	var entries []Entry
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return nil, fmt.Errorf("parse tart list output: %w", err)
+	}
+	for i := range entries {
+		// Older Tart releases only report the Running flag
+		if entries[i].State == "" {
+			if entries[i].Running {
+				entries[i].State = "running"
+			} else {
+				entries[i].State = "stopped"
+			}
+		}
+	}
+	return entries, nil
+}
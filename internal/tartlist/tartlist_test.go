@@ -0,0 +1,33 @@
+package tartlist
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	out := []byte(`[
+  {"Source":"local","Name":"vm-a","Disk":50,"Size":21,"State":"running","Running":true},
+  {"Source":"local","Name":"vm-b","Disk":20,"Size":5,"Running":false},
+  {"Source":"OCI","Name":"ghcr.io/cirruslabs/ubuntu:latest","Disk":20,"Size":4,"Running":false}
+]`)
+	entries, err := Parse(out)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].State != "running" {
+		t.Errorf("vm-a: expected running, got %q", entries[0].State)
+	}
+	if entries[1].State != "stopped" {
+		t.Errorf("vm-b: expected state derived from Running flag, got %q", entries[1].State)
+	}
+	if entries[2].Source != "OCI" || entries[2].Disk != 20 {
+		t.Errorf("unexpected OCI entry: %+v", entries[2])
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	if _, err := Parse([]byte("NAME SOURCE")); err == nil {
+		t.Fatalf("expected error for non-JSON output")
+	}
+}
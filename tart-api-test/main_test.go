@@ -6,22 +6,71 @@ import (
     "net/http"
     "net/http/httptest"
     "os"
+    "strings"
     "testing"
 
     "github.com/beleganjur/terraform-provider-tart/tart"
     "github.com/stretchr/testify/assert"
 )
 
-var (
-    apiURL   string
-    apiToken = getenv("TART_API_TOKEN", "")
-)
+var apiURL, apiToken = profileSettings()
 
-func getenv(key, fallback string) string {
-    if val := os.Getenv(key); val != "" {
-        return val
+// profileSettings reads the controller URL and bearer token the same way the
+// provider does: the TART_PROFILE entry of ~/.config/tart/credentials, then
+// TART_API_URL and TART_API_TOKEN.
+func profileSettings() (string, string) {
+    p, err := tart.ResolveProfile("")
+    if err != nil {
+        return "", ""
     }
-    return fallback
+    return strings.TrimSuffix(p.URL, "/"), p.Token
+}
+
+// mutateRemote opts the tests that create and delete VMs into the resolved controller.
+// Without it they run in-process, so a plain run never leaves VMs behind on a shared host.
+var mutateRemote = os.Getenv("TART_API_TEST_MUTATE") == "1"
+
+// apiBase returns the API base URL the read-only tests talk to: the controller from
+// the profile when one is configured, otherwise an in-process router.
+func apiBase(t *testing.T) string {
+    t.Helper()
+    if apiURL != "" {
+        return apiURL
+    }
+    return localAPIBase(t)
+}
+
+// mutatingAPIBase returns the API base URL for tests that create VMs: the in-process
+// router unless TART_API_TEST_MUTATE=1 and a controller is configured.
+func mutatingAPIBase(t *testing.T) string {
+    t.Helper()
+    if mutateRemote && apiURL != "" {
+        return apiURL
+    }
+    return localAPIBase(t)
+}
+
+// localAPIBase starts the controller router in-process, backed by executorStub.
+func localAPIBase(t *testing.T) string {
+    t.Helper()
+    execSrv := executorStub(t)
+    t.Cleanup(execSrv.Close)
+    t.Setenv("EXECUTOR_URL", execSrv.URL)
+    srv := httptest.NewServer(tart.SetupRouter())
+    t.Cleanup(srv.Close)
+    return srv.URL + "/api"
+}
+
+// deleteVMAfter removes the VM once the test is done, even when it fails half-way.
+func deleteVMAfter(t *testing.T, base, name string) {
+    t.Helper()
+    t.Cleanup(func() {
+        req, _ := http.NewRequest(http.MethodDelete, base+"/vms/"+name, nil)
+        if apiToken != "" { req.Header.Set("Authorization", "Bearer "+apiToken) }
+        if resp, err := http.DefaultClient.Do(req); err == nil {
+            resp.Body.Close()
+        }
+    })
 }
 
 // executorStub starts a local HTTP server that simulates the executor /execute endpoint.
@@ -37,22 +86,18 @@ func executorStub(t *testing.T) *httptest.Server {
     return httptest.NewServer(mux)
 }
 func TestListVMs(t *testing.T) {
-    execSrv := executorStub(t)
-    defer execSrv.Close()
-    os.Setenv("EXECUTOR_URL", execSrv.URL)
-    defer os.Unsetenv("EXECUTOR_URL")
-    
-    srv := httptest.NewServer(tart.SetupRouter())
-    defer srv.Close()
-    base := srv.URL + "/api"
-    
+    base := mutatingAPIBase(t)
+    deleteVMAfter(t, base, "list-test")
+
     // Create
     body, _ := json.Marshal(map[string]string{"name": "list-test", "image": "debian-13"})
     req, _ := http.NewRequest(http.MethodPost, base+"/vms", bytes.NewReader(body))
     req.Header.Set("Content-Type", "application/json")
+    if apiToken != "" { req.Header.Set("Authorization", "Bearer "+apiToken) }
     _, _ = http.DefaultClient.Do(req)
     // Now list
     req, _ = http.NewRequest(http.MethodGet, base+"/vms", nil)
+    if apiToken != "" { req.Header.Set("Authorization", "Bearer "+apiToken) }
     resp, _ := http.DefaultClient.Do(req)
     var vms []map[string]interface{}
     _ = json.NewDecoder(resp.Body).Decode(&vms)
@@ -60,10 +105,9 @@ func TestListVMs(t *testing.T) {
 }
 
 func TestListImages(t *testing.T) {
-    srv := httptest.NewServer(tart.SetupRouter())
-    defer srv.Close()
+    base := apiBase(t)
 
-    req, _ := http.NewRequest(http.MethodGet, apiURL+"/images", nil)
+    req, _ := http.NewRequest(http.MethodGet, base+"/images", nil)
     if apiToken != "" {
         req.Header.Set("Authorization", "Bearer "+apiToken)
     }
@@ -79,15 +123,8 @@ func TestListImages(t *testing.T) {
 
 // Test a full VM lifecycle using the API with a stubbed executor
 func TestVMLifecycle_CreateGetDelete(t *testing.T) {
-    execSrv := executorStub(t)
-    defer execSrv.Close()
-    // Point API to the stubbed executor
-    os.Setenv("EXECUTOR_URL", execSrv.URL)
-    defer os.Unsetenv("EXECUTOR_URL")
-
-    apiSrv := httptest.NewServer(tart.SetupRouter())
-    defer apiSrv.Close()
-    base := apiSrv.URL + "/api"
+    base := mutatingAPIBase(t)
+    deleteVMAfter(t, base, "test-trash")
 
     // Create VM
     payload := map[string]string{"name": "test-trash", "image": "debian-13"}
@@ -1,3 +1,8 @@
+# Either pick a profile from ~/.config/tart/credentials (shared with the provider) ...
+# export TART_PROFILE="dev"
+# ... or set the endpoint explicitly.
 export TART_API_URL="http://localhost:8085/api"
 export TART_API_TOKEN="<your_token>"
+# Tests that create VMs stay in-process unless this is set; they clean up after themselves.
+# export TART_API_TEST_MUTATE=1
 go test -v
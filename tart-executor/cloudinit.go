@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// seedDir is where the executor keeps a VM's NoCloud seed image, next to the image cache.
+func seedDir(name string) string {
+	return filepath.Join(os.Getenv("HOME"), ".cache", "tart-seeds", name)
+}
+
+func seedPath(name string) string {
+	return filepath.Join(seedDir(name), "cidata.iso")
+}
+
+// seedAttachedMarker records that the seed was already handed to `tart run` once.
+func seedAttachedMarker(name string) string {
+	return filepath.Join(seedDir(name), "attached")
+}
+
+// defaultMetaData names the instance after the VM; cloud-init requires meta-data to exist.
+func defaultMetaData(name string) string {
+	return fmt.Sprintf("instance-id: %s\nlocal-hostname: %s\n", name, name)
+}
+
+// withPublicKeys adds SSH keys to NoCloud meta-data as public-keys, which
+// cloud-init installs for the image's default user.
+func withPublicKeys(name, metaData string, keys []string) (string, error) {
+	if len(keys) == 0 {
+		return metaData, nil
+	}
+	if metaData == "" {
+		metaData = defaultMetaData(name)
+	}
+	md := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(metaData), &md); err != nil {
+		return "", fmt.Errorf("parsing meta-data: %w", err)
+	}
+	var merged []interface{}
+	switch existing := md["public-keys"].(type) {
+	case []interface{}:
+		merged = existing
+	case string:
+		merged = []interface{}{existing}
+	}
+	for _, k := range keys {
+		merged = append(merged, k)
+	}
+	md["public-keys"] = merged
+	b, err := yaml.Marshal(md)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// writeNoCloudSeed builds the cidata ISO for a VM. meta-data is required by
+// cloud-init, so a minimal one naming the instance is generated when empty.
+func writeNoCloudSeed(name, userData, metaData, networkConfig string) (string, error) {
+	if metaData == "" {
+		metaData = defaultMetaData(name)
+	}
+	files := []isoFile{
+		{Name: "user-data", Data: []byte(userData)},
+		{Name: "meta-data", Data: []byte(metaData)},
+	}
+	if networkConfig != "" {
+		files = append(files, isoFile{Name: "network-config", Data: []byte(networkConfig)})
+	}
+	if err := os.MkdirAll(seedDir(name), 0o700); err != nil {
+		return "", err
+	}
+	// A fresh seed must be attached again on the next run
+	if err := os.Remove(seedAttachedMarker(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	path := seedPath(name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if err := writeISO9660(f, "cidata", files, time.Now()); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// pendingSeedDisk returns the seed image path if the VM has one that was never attached.
+func pendingSeedDisk(name string) string {
+	if _, err := os.Stat(seedPath(name)); err != nil {
+		return ""
+	}
+	if _, err := os.Stat(seedAttachedMarker(name)); err == nil {
+		return ""
+	}
+	return seedPath(name)
+}
+
+func markSeedAttached(name string) error {
+	return os.WriteFile(seedAttachedMarker(name), nil, 0o600)
+}
+
+// moveSeedDir follows a VM rename, so a pending seed or SSH keys still apply to it.
+func moveSeedDir(oldName, newName string) error {
+	err := os.Rename(seedDir(oldName), seedDir(newName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCreateSeedAction(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"action": "create_seed",
+		"data": map[string]string{
+			"name":      "ci-vm",
+			"user_data": "#cloud-config\npackages: [git]\n",
+		},
+	})
+	rec := httptest.NewRecorder()
+	handleExecute(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp["path"] != seedPath("ci-vm") {
+		t.Fatalf("unexpected seed path %q", resp["path"])
+	}
+
+	img, err := os.ReadFile(resp["path"])
+	if err != nil {
+		t.Fatalf("seed not written: %v", err)
+	}
+	files := readISORoot(t, img, isoSVDSector, true)
+	if files["user-data"] != "#cloud-config\npackages: [git]\n" {
+		t.Fatalf("unexpected user-data %q", files["user-data"])
+	}
+	if files["meta-data"] != "instance-id: ci-vm\nlocal-hostname: ci-vm\n" {
+		t.Fatalf("expected generated meta-data, got %q", files["meta-data"])
+	}
+	if _, ok := files["network-config"]; ok {
+		t.Fatalf("network-config should be omitted when empty")
+	}
+
+	// The seed is attached exactly once
+	if pendingSeedDisk("ci-vm") == "" {
+		t.Fatalf("expected a pending seed before the first run")
+	}
+	if err := markSeedAttached("ci-vm"); err != nil {
+		t.Fatal(err)
+	}
+	if pendingSeedDisk("ci-vm") != "" {
+		t.Fatalf("expected no pending seed after the first run")
+	}
+}
+
+func TestCreateSeedAction_MissingName(t *testing.T) {
+	body := []byte(`{"action":"create_seed","data":{"user_data":"#cloud-config"}}`)
+	rec := httptest.NewRecorder()
+	handleExecute(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestWithPublicKeys(t *testing.T) {
+	md, err := withPublicKeys("vm-a", "", []string{"ssh-ed25519 AAAA one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed map[string]interface{}
+	if err := yaml.Unmarshal([]byte(md), &parsed); err != nil {
+		t.Fatalf("generated meta-data is not YAML: %v", err)
+	}
+	if parsed["instance-id"] != "vm-a" || parsed["local-hostname"] != "vm-a" {
+		t.Fatalf("expected default meta-data fields, got %v", parsed)
+	}
+	keys, _ := parsed["public-keys"].([]interface{})
+	if len(keys) != 1 || keys[0] != "ssh-ed25519 AAAA one" {
+		t.Fatalf("unexpected public-keys %v", parsed["public-keys"])
+	}
+
+	// Keys already present in user meta-data are kept
+	md, err = withPublicKeys("vm-a", "instance-id: custom\npublic-keys: ssh-rsa AAAA old\n", []string{"ssh-ed25519 AAAA new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed = nil
+	_ = yaml.Unmarshal([]byte(md), &parsed)
+	keys, _ = parsed["public-keys"].([]interface{})
+	if parsed["instance-id"] != "custom" || len(keys) != 2 || keys[0] != "ssh-rsa AAAA old" {
+		t.Fatalf("unexpected merged meta-data %v", parsed)
+	}
+
+	if md, _ := withPublicKeys("vm-a", "", nil); md != "" {
+		t.Fatalf("expected meta-data untouched without keys, got %q", md)
+	}
+}
+
+func TestCreateSeedAction_SSHKeys(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("TART_HOME", home)
+	writeConfig := func(name, guest string) {
+		dir := filepath.Join(home, "vms", name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"os":"`+guest+`"}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createSeed := func(name string) map[string]string {
+		body, _ := json.Marshal(map[string]interface{}{
+			"action": "create_seed",
+			"data": map[string]interface{}{
+				"name":                name,
+				"ssh_authorized_keys": []string{"ssh-ed25519 AAAA key"},
+			},
+		})
+		rec := httptest.NewRecorder()
+		handleExecute(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp map[string]string
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// Linux guests get the keys through cloud-init meta-data
+	writeConfig("linux-vm", "linux")
+	resp := createSeed("linux-vm")
+	img, err := os.ReadFile(resp["path"])
+	if err != nil {
+		t.Fatalf("seed not written: %v", err)
+	}
+	files := readISORoot(t, img, isoSVDSector, true)
+	if !strings.Contains(files["meta-data"], "ssh-ed25519 AAAA key") {
+		t.Fatalf("expected key in meta-data, got %q", files["meta-data"])
+	}
+
+	// macOS guests queue them for the guest agent and need no seed
+	writeConfig("mac-vm", "darwin")
+	resp = createSeed("mac-vm")
+	if resp["path"] != "" {
+		t.Fatalf("expected no seed for a macOS guest, got %q", resp["path"])
+	}
+	queued, err := os.ReadFile(pendingKeysPath("mac-vm"))
+	if err != nil || string(queued) != "ssh-ed25519 AAAA key\n" {
+		t.Fatalf("expected queued key, got %q (%v)", queued, err)
+	}
+}
+
+func TestMoveSeedDir(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := moveSeedDir("none", "other"); err != nil {
+		t.Fatalf("moving a missing seed dir should be a no-op, got %v", err)
+	}
+	if _, err := writeNoCloudSeed("old-vm", "#cloud-config\n", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveSeedDir("old-vm", "new-vm"); err != nil {
+		t.Fatal(err)
+	}
+	if pendingSeedDisk("new-vm") == "" || pendingSeedDisk("old-vm") != "" {
+		t.Fatalf("expected the pending seed to follow the rename")
+	}
+}
+
+func TestRunVM_SeedMarkedOnlyOnceRunning(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	fakeTart(t, `state="$HOME/state"
+case "$1" in
+run)
+  [ -n "$FAKE_RUN_FAIL" ] && { echo "VM is locked" >&2; exit 1; }
+  echo running > "$state"; exec sleep 1 ;;
+list)
+  s=stopped; [ -e "$state" ] && s=$(cat "$state")
+  printf '[{"Source":"local","Name":"ci-vm","State":"%s"}]' "$s" ;;
+esac
+`)
+	vmStartPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { vmStartPollInterval = time.Second })
+	if _, err := writeNoCloudSeed("ci-vm", "#cloud-config\n", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("FAKE_RUN_FAIL", "1")
+	if rec := executeAction(t, "run_vm", map[string]interface{}{"name": "ci-vm", "detach": true}); rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502 when tart run exits, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if pendingSeedDisk("ci-vm") == "" {
+		t.Fatalf("a failed run must leave the seed pending")
+	}
+
+	t.Setenv("FAKE_RUN_FAIL", "")
+	if rec := executeAction(t, "run_vm", map[string]interface{}{"name": "ci-vm", "detach": true}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if pendingSeedDisk("ci-vm") != "" {
+		t.Fatalf("expected the seed to be marked attached once the VM runs")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+)
+
+// validDiskName keeps disk names usable as file names inside diskDir.
+var validDiskName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// diskDir holds the executor-managed data disks, next to the image cache.
+func diskDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".cache", "tart-disks")
+}
+
+func diskPath(name string) (string, error) {
+	if !validDiskName.MatchString(name) {
+		return "", fmt.Errorf("invalid disk name %q", name)
+	}
+	return filepath.Join(diskDir(), name+".img"), nil
+}
+
+// diskInfo describes a data disk; SizeGB is the apparent size, not the blocks in use.
+// Label is the ext4 volume label, empty for blank disks.
+type diskInfo struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	SizeGB int    `json:"size_gb"`
+	Label  string `json:"label,omitempty"`
+}
+
+func statDisk(name string) (*diskInfo, error) {
+	p, err := diskPath(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	return &diskInfo{Name: name, Path: p, SizeGB: int(fi.Size() >> 30), Label: ext4Label(p)}, nil
+}
+
+// ext4Label reads the volume label from the ext4 superblock at offset 1024,
+// returning "" when the image holds no ext4 filesystem.
+func ext4Label(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sb := make([]byte, 0x88)
+	if _, err := f.ReadAt(sb, 1024); err != nil {
+		return ""
+	}
+	if binary.LittleEndian.Uint16(sb[0x38:]) != 0xEF53 {
+		return ""
+	}
+	name := sb[0x78:0x88]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return string(name)
+}
+
+// createDisk makes a sparse raw image of sizeGB. With a label the image is
+// formatted as ext4 (mkfs.ext4 from e2fsprogs), so Linux guests can mount it
+// by /dev/disk/by-label/<label>; without one it is left blank.
+func createDisk(name string, sizeGB int, label string) (*diskInfo, error) {
+	if sizeGB <= 0 {
+		return nil, errors.New("size_gb must be positive")
+	}
+	p, err := diskPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(diskDir(), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	err = f.Truncate(int64(sizeGB) << 30)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && label != "" {
+		err = formatExt4(p, label)
+	}
+	if err != nil {
+		os.Remove(p)
+		return nil, err
+	}
+	return statDisk(name)
+}
+
+func formatExt4(path, label string) error {
+	mkfs, err := exec.LookPath("mkfs.ext4")
+	if err != nil {
+		return errors.New("mkfs.ext4 not found in PATH; install e2fsprogs to create labelled disks")
+	}
+	cmd := exec.Command(mkfs, "-q", "-F", "-L", label, path)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// growDisk extends the image to sizeGB. The guest still has to grow its
+// filesystem; shrinking is refused because it would cut off data.
+func growDisk(name string, sizeGB int) (*diskInfo, error) {
+	info, err := statDisk(name)
+	if err != nil {
+		return nil, err
+	}
+	if sizeGB < info.SizeGB {
+		return nil, fmt.Errorf("disk %s cannot shrink from %d GB to %d GB", name, info.SizeGB, sizeGB)
+	}
+	if err := os.Truncate(info.Path, int64(sizeGB)<<30); err != nil {
+		return nil, err
+	}
+	return statDisk(name)
+}
+
+// attachedDisk mirrors the controller's disk attachments in run_vm payloads.
+type attachedDisk struct {
+	Name     string `json:"name"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// diskArg renders an attachment as the value of `tart run --disk`.
+func diskArg(d attachedDisk) (string, error) {
+	info, err := statDisk(d.Name)
+	if err != nil {
+		return "", fmt.Errorf("disk %s: %w", d.Name, err)
+	}
+	if d.ReadOnly {
+		return info.Path + ":ro", nil
+	}
+	return info.Path, nil
+}
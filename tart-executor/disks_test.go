@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func executeAction(t *testing.T, action string, data interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"action": action, "data": data})
+	rec := httptest.NewRecorder()
+	handleExecute(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(body)))
+	return rec
+}
+
+func TestDiskActions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	rec := executeAction(t, "create_disk", map[string]interface{}{"name": "cache", "size_gb": 2})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create_disk: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Disk diskInfo `json:"disk"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.Disk.SizeGB != 2 {
+		t.Fatalf("expected a 2 GB disk, got %+v", created.Disk)
+	}
+	fi, err := os.Stat(created.Disk.Path)
+	if err != nil || fi.Size() != 2<<30 {
+		t.Fatalf("expected a 2 GiB image at %s: %v", created.Disk.Path, err)
+	}
+
+	if rec := executeAction(t, "create_disk", map[string]interface{}{"name": "cache", "size_gb": 2}); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for an existing disk, got %d", rec.Code)
+	}
+	if rec := executeAction(t, "create_disk", map[string]interface{}{"name": "../etc", "size_gb": 1}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a path-like name, got %d", rec.Code)
+	}
+
+	if rec := executeAction(t, "resize_disk", map[string]interface{}{"name": "cache", "size_gb": 3}); rec.Code != http.StatusOK {
+		t.Fatalf("resize_disk: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := executeAction(t, "resize_disk", map[string]interface{}{"name": "cache", "size_gb": 1}); rec.Code == http.StatusOK {
+		t.Fatalf("expected shrinking to fail")
+	}
+	if info, _ := statDisk("cache"); info == nil || info.SizeGB != 3 {
+		t.Fatalf("expected disk grown to 3 GB, got %+v", info)
+	}
+
+	if arg, err := diskArg(attachedDisk{Name: "cache", ReadOnly: true}); err != nil || arg != created.Disk.Path+":ro" {
+		t.Fatalf("unexpected --disk value %q (%v)", arg, err)
+	}
+	if _, err := diskArg(attachedDisk{Name: "missing"}); err == nil {
+		t.Fatalf("expected an error for an unknown disk")
+	}
+
+	if rec := executeAction(t, "delete_disk", map[string]string{"name": "cache"}); rec.Code != http.StatusOK {
+		t.Fatalf("delete_disk: expected 200, got %d", rec.Code)
+	}
+	rec = executeAction(t, "disk_info", map[string]string{"name": "cache"})
+	var info struct {
+		Present bool `json:"present"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &info)
+	if rec.Code != http.StatusOK || info.Present {
+		t.Fatalf("expected deleted disk to be absent, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStatDisk_Label(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	info, err := createDisk("data", 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Label != "" {
+		t.Fatalf("expected a blank disk to have no label, got %q", info.Label)
+	}
+
+	// What mkfs.ext4 -L data-vol leaves in the superblock
+	sb := make([]byte, 0x88)
+	binary.LittleEndian.PutUint16(sb[0x38:], 0xEF53)
+	copy(sb[0x78:], "data-vol")
+	f, err := os.OpenFile(info.Path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt(sb, 1024)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := statDisk("data"); info == nil || info.Label != "data-vol" {
+		t.Fatalf("expected label data-vol, got %+v", info)
+	}
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+    "bytes"
+    "context"
     "encoding/json"
     "errors"
     "fmt"
     "io"
+    "io/fs"
+    "log"
     "net/http"
     "os"
     "os/exec"
     "path/filepath"
+    "strconv"
+    "strings"
     "time"
 )
 
@@ -26,8 +32,12 @@ func handleExecute(w http.ResponseWriter, r *http.Request) {
 
     switch req.Action {
     case "pull_image":
-        // Expect { ref: string }
-        var payload struct{ Ref string `json:"ref"` }
+        // Expect { ref: string, username?, password? }; credentials only live in the pull's environment
+        var payload struct {
+            Ref      string `json:"ref"`
+            Username string `json:"username"`
+            Password string `json:"password"`
+        }
         if err := json.Unmarshal(req.Data, &payload); err != nil {
             http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
             return
@@ -36,13 +46,159 @@ func handleExecute(w http.ResponseWriter, r *http.Request) {
             http.Error(w, "missing ref", http.StatusBadRequest)
             return
         }
-        if err := execTart("pull", payload.Ref); err != nil {
+        if err := execTartEnv(r.Context(), registryEnv(payload.Username, payload.Password), "pull", payload.Ref); err != nil {
             http.Error(w, fmt.Sprintf("tart pull failed: %v", err), http.StatusBadGateway)
             return
         }
         json.NewEncoder(w).Encode(map[string]string{"result": "executed"})
         return
 
+    case "image_info":
+        // Expect { ref: string }; responds with { present, digest, size_gb } for the cached OCI image
+        var payload struct{ Ref string `json:"ref"` }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        if payload.Ref == "" {
+            http.Error(w, "missing ref", http.StatusBadRequest)
+            return
+        }
+        entries, err := listTartVMs()
+        if err != nil {
+            http.Error(w, fmt.Sprintf("tart list failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        resp := map[string]interface{}{"result": "executed", "present": false}
+        for _, e := range entries {
+            if strings.EqualFold(e.Source, "oci") && e.Name == payload.Ref {
+                resp["present"] = true
+                resp["size_gb"] = e.Size
+                if digest, err := localImageDigest(payload.Ref); err == nil {
+                    resp["digest"] = digest
+                }
+                break
+            }
+        }
+        json.NewEncoder(w).Encode(resp)
+        return
+
+    case "resolve_digest":
+        // Expect { ref: string, username?, password? }; responds with { digest } as currently published by the registry
+        var payload struct {
+            Ref      string `json:"ref"`
+            Username string `json:"username"`
+            Password string `json:"password"`
+        }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        if payload.Ref == "" {
+            http.Error(w, "missing ref", http.StatusBadRequest)
+            return
+        }
+        digest, err := resolveRemoteDigest(http.DefaultClient, "https", payload.Ref, payload.Username, payload.Password)
+        if err != nil {
+            http.Error(w, fmt.Sprintf("resolve digest failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]string{"result": "executed", "digest": digest})
+        return
+
+    case "delete_image":
+        // Expect { ref: string }; removes the image from Tart's OCI cache
+        var payload struct{ Ref string `json:"ref"` }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        if payload.Ref == "" {
+            http.Error(w, "missing ref", http.StatusBadRequest)
+            return
+        }
+        if err := execTart("delete", payload.Ref); err != nil {
+            http.Error(w, fmt.Sprintf("tart delete failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]string{"result": "executed"})
+        return
+
+    case "create_disk", "resize_disk":
+        // Expect { name, size_gb, label? }; responds with { disk: { name, path, size_gb } }
+        var payload struct {
+            Name   string `json:"name"`
+            SizeGB int    `json:"size_gb"`
+            Label  string `json:"label"`
+        }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        if _, err := diskPath(payload.Name); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        var info *diskInfo
+        var err error
+        if req.Action == "create_disk" {
+            info, err = createDisk(payload.Name, payload.SizeGB, payload.Label)
+        } else {
+            info, err = growDisk(payload.Name, payload.SizeGB)
+        }
+        if errors.Is(err, fs.ErrExist) {
+            http.Error(w, fmt.Sprintf("disk %s already exists", payload.Name), http.StatusConflict)
+            return
+        }
+        if errors.Is(err, fs.ErrNotExist) {
+            http.Error(w, fmt.Sprintf("disk %s not found", payload.Name), http.StatusNotFound)
+            return
+        }
+        if err != nil {
+            http.Error(w, fmt.Sprintf("%s failed: %v", req.Action, err), http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{"result": "executed", "disk": info})
+        return
+
+    case "disk_info":
+        // Expect { name }; responds with { present: bool, disk? }
+        var payload struct{ Name string `json:"name"` }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        info, err := statDisk(payload.Name)
+        if errors.Is(err, fs.ErrNotExist) {
+            json.NewEncoder(w).Encode(map[string]interface{}{"result": "executed", "present": false})
+            return
+        }
+        if err != nil {
+            http.Error(w, fmt.Sprintf("disk_info failed: %v", err), http.StatusBadRequest)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{"result": "executed", "present": true, "disk": info})
+        return
+
+    case "delete_disk":
+        // Expect { name }; deleting a missing disk succeeds
+        var payload struct{ Name string `json:"name"` }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        p, err := diskPath(payload.Name)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+            http.Error(w, fmt.Sprintf("delete_disk failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]string{"result": "executed"})
+        return
+
     case "clone_vm":
         // Expect { name: string, image: string }
         var payload struct{ Name, Image string }
@@ -54,12 +210,100 @@ func handleExecute(w http.ResponseWriter, r *http.Request) {
             http.Error(w, "missing name or image", http.StatusBadRequest)
             return
         }
-        if err := execTart("clone", payload.Image, payload.Name); err != nil {
+        // A cancelled request kills the clone instead of leaving a VM the controller never records
+        if err := execTartEnv(r.Context(), nil, "clone", payload.Image, payload.Name); err != nil {
             http.Error(w, fmt.Sprintf("tart clone failed: %v", err), http.StatusBadGateway)
             return
         }
         json.NewEncoder(w).Encode(map[string]string{"result": "executed"})
         return
+    case "set_vm":
+        // Expect { name: string, cpu?: int, memory_mb?: int, disk_size_gb?: int }
+        var payload struct {
+            Name       string `json:"name"`
+            CPU        int    `json:"cpu"`
+            MemoryMB   int    `json:"memory_mb"`
+            DiskSizeGB int    `json:"disk_size_gb"`
+        }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        if payload.Name == "" {
+            http.Error(w, "missing name", http.StatusBadRequest)
+            return
+        }
+        args := []string{payload.Name}
+        if payload.CPU > 0 {
+            args = append(args, "--cpu", strconv.Itoa(payload.CPU))
+        }
+        if payload.MemoryMB > 0 {
+            args = append(args, "--memory", strconv.Itoa(payload.MemoryMB))
+        }
+        if payload.DiskSizeGB > 0 {
+            args = append(args, "--disk-size", strconv.Itoa(payload.DiskSizeGB))
+        }
+        if len(args) == 1 {
+            http.Error(w, "nothing to set", http.StatusBadRequest)
+            return
+        }
+        if err := execTart("set", args...); err != nil {
+            http.Error(w, fmt.Sprintf("tart set failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]string{"result": "executed"})
+        return
+
+    case "get_ip":
+        // Expect { name: string, wait?: int seconds }; responds with { ip, mac }
+        var payload struct {
+            Name string `json:"name"`
+            Wait int    `json:"wait"`
+        }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        if payload.Name == "" {
+            http.Error(w, "missing name", http.StatusBadRequest)
+            return
+        }
+        args := []string{payload.Name}
+        if payload.Wait > 0 {
+            args = append([]string{"--wait", strconv.Itoa(payload.Wait)}, args...)
+        }
+        out, err := execTartOutput("ip", args...)
+        if err != nil {
+            http.Error(w, fmt.Sprintf("tart ip failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        mac, err := vmMACAddress(payload.Name)
+        if err != nil {
+            log.Printf("reading MAC address of %s: %v", payload.Name, err)
+        }
+        json.NewEncoder(w).Encode(map[string]string{"result": "executed", "ip": strings.TrimSpace(string(out)), "mac": mac})
+        return
+
+    case "list_images":
+        // Responds with { images: [{ name, source, disk_gb, size_gb, last_accessed, state }] }
+        entries, err := listTartVMs()
+        if err != nil {
+            http.Error(w, fmt.Sprintf("tart list failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{"result": "executed", "images": toImageInfos(entries)})
+        return
+
+    case "list_interfaces":
+        // Responds with { interfaces: [{ name, display_name }] } for bridged networking
+        ifaces, err := listHostInterfaces()
+        if err != nil {
+            http.Error(w, fmt.Sprintf("listing interfaces failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{"result": "executed", "interfaces": ifaces})
+        return
+
     case "download_image":
         // Expect { url: string, destName: string }
         var payload struct {
@@ -83,6 +327,157 @@ func handleExecute(w http.ResponseWriter, r *http.Request) {
         return
 
     case "run_vm":
+        // Expect { id: string } or { name: string }, optional detach: bool, dirs: [shared directory] with
+        // the controller's allowlist, network and disks
+        var payload struct {
+            ID        string         `json:"id"`
+            Name      string         `json:"name"`
+            Detach    bool           `json:"detach"`
+            Dirs      []sharedDir    `json:"dirs"`
+            Allowlist []string       `json:"allowlist"`
+            Network   *vmNetwork     `json:"network"`
+            Disks     []attachedDisk `json:"disks"`
+        }
+        _ = json.Unmarshal(req.Data, &payload)
+        name := payload.ID
+        if name == "" {
+            name = payload.Name
+        }
+        if name == "" {
+            http.Error(w, "missing id/name", http.StatusBadRequest)
+            return
+        }
+        args := []string{name}
+        // The cloud-init seed is only attached on the VM's first run
+        seed := pendingSeedDisk(name)
+        if seed != "" {
+            args = append(args, "--disk", seed+":ro")
+        }
+        dirs, err := resolveSharedDirs(payload.Dirs, payload.Allowlist)
+        var denied sharedDirNotAllowedError
+        if errors.As(err, &denied) {
+            http.Error(w, err.Error(), http.StatusForbidden)
+            return
+        }
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        for _, d := range dirs {
+            args = append(args, "--dir", dirArg(d))
+        }
+        args = append(args, netArgs(payload.Network)...)
+        for _, d := range payload.Disks {
+            arg, err := diskArg(d)
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            args = append(args, "--disk", arg)
+        }
+        if payload.Detach {
+            // Start headless and return immediately; the VM keeps running after this request.
+            exited, err := startTartDetached("run", append(args, "--no-graphics")...)
+            if err != nil {
+                http.Error(w, fmt.Sprintf("tart run failed: %v", err), http.StatusBadGateway)
+                return
+            }
+            // tart run can fail right after starting (bad disk, VM locked); the seed only counts as attached once the VM is up
+            if err := waitUntilRunning(name, exited, vmStartTimeout); err != nil {
+                http.Error(w, fmt.Sprintf("tart run failed: %v", err), http.StatusBadGateway)
+                return
+            }
+            if seed != "" {
+                if err := markSeedAttached(name); err != nil {
+                    log.Printf("marking seed of %s as attached: %v", name, err)
+                }
+            }
+            // The guest agent may take minutes to come up; the VM is already running, so install
+            // queued keys in the background. They stay queued on failure and the next run retries.
+            go func() {
+                if err := installPendingSSHKeys(name, 5*time.Minute); err != nil {
+                    log.Printf("installing SSH keys on %s: %v", name, err)
+                }
+            }()
+            json.NewEncoder(w).Encode(map[string]string{"result": "executed"})
+            return
+        }
+        // A foreground run only returns once the VM stops, so mark the seed and install keys alongside it
+        exited := make(chan error, 1)
+        go func() {
+            if err := waitUntilRunning(name, exited, vmStartTimeout); err != nil {
+                log.Printf("vm %s did not start: %v", name, err)
+                return
+            }
+            if seed != "" {
+                if err := markSeedAttached(name); err != nil {
+                    log.Printf("marking seed of %s as attached: %v", name, err)
+                }
+            }
+            if err := installPendingSSHKeys(name, 5*time.Minute); err != nil {
+                log.Printf("installing SSH keys on %s: %v", name, err)
+            }
+        }()
+        err = execTart("run", args...)
+        exited <- err
+        if err != nil {
+            http.Error(w, fmt.Sprintf("tart run failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]string{"result": "executed"})
+        return
+
+    case "create_seed":
+        // Expect { name, user_data?, meta_data?, network_config?, ssh_authorized_keys? }; builds the NoCloud cidata ISO.
+        // SSH keys go into the seed for Linux guests and are queued for the guest agent on macOS.
+        var payload struct {
+            Name              string   `json:"name"`
+            UserData          string   `json:"user_data"`
+            MetaData          string   `json:"meta_data"`
+            NetworkConfig     string   `json:"network_config"`
+            SSHAuthorizedKeys []string `json:"ssh_authorized_keys"`
+        }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        if payload.Name == "" {
+            http.Error(w, "missing name", http.StatusBadRequest)
+            return
+        }
+        keys := payload.SSHAuthorizedKeys
+        if len(keys) > 0 {
+            guest, err := vmOS(payload.Name)
+            if err != nil {
+                http.Error(w, fmt.Sprintf("reading VM config failed: %v", err), http.StatusBadGateway)
+                return
+            }
+            if guest == "darwin" {
+                if err := writePendingSSHKeys(payload.Name, keys); err != nil {
+                    http.Error(w, fmt.Sprintf("storing SSH keys failed: %v", err), http.StatusBadGateway)
+                    return
+                }
+                keys = nil
+            }
+        }
+        resp := map[string]string{"result": "executed"}
+        if payload.UserData != "" || payload.MetaData != "" || payload.NetworkConfig != "" || len(keys) > 0 {
+            metaData, err := withPublicKeys(payload.Name, payload.MetaData, keys)
+            if err != nil {
+                http.Error(w, fmt.Sprintf("invalid meta_data: %v", err), http.StatusBadRequest)
+                return
+            }
+            path, err := writeNoCloudSeed(payload.Name, payload.UserData, metaData, payload.NetworkConfig)
+            if err != nil {
+                http.Error(w, fmt.Sprintf("create seed failed: %v", err), http.StatusBadGateway)
+                return
+            }
+            resp["path"] = path
+        }
+        json.NewEncoder(w).Encode(resp)
+        return
+
+    case "stop_vm", "suspend_vm":
         // Expect { id: string } or { name: string }
         var payload map[string]string
         _ = json.Unmarshal(req.Data, &payload)
@@ -94,13 +489,40 @@ func handleExecute(w http.ResponseWriter, r *http.Request) {
             http.Error(w, "missing id/name", http.StatusBadRequest)
             return
         }
-        if err := execTart("run", name); err != nil {
-            http.Error(w, fmt.Sprintf("tart run failed: %v", err), http.StatusBadGateway)
+        subcmd := "stop"
+        if req.Action == "suspend_vm" {
+            subcmd = "suspend"
+        }
+        if err := execTart(subcmd, name); err != nil {
+            http.Error(w, fmt.Sprintf("tart %s failed: %v", subcmd, err), http.StatusBadGateway)
             return
         }
         json.NewEncoder(w).Encode(map[string]string{"result": "executed"})
         return
 
+    case "get_vm_state":
+        // Expect { name: string }; responds with { present: bool, state: running|stopped|suspended, disk_gb }
+        var payload struct{ Name string `json:"name"` }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        if payload.Name == "" {
+            http.Error(w, "missing name", http.StatusBadRequest)
+            return
+        }
+        vm, err := findLocalVM(payload.Name)
+        if errors.Is(err, errVMNotFound) {
+            json.NewEncoder(w).Encode(map[string]interface{}{"result": "executed", "present": false})
+            return
+        }
+        if err != nil {
+            http.Error(w, fmt.Sprintf("tart list failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{"result": "executed", "present": true, "state": vm.State, "disk_gb": vm.Disk})
+        return
+
     case "delete_vm":
         var payload map[string]string
         _ = json.Unmarshal(req.Data, &payload)
@@ -116,6 +538,94 @@ func handleExecute(w http.ResponseWriter, r *http.Request) {
             http.Error(w, fmt.Sprintf("tart delete failed: %v", err), http.StatusBadGateway)
             return
         }
+        if err := os.RemoveAll(seedDir(name)); err != nil {
+            log.Printf("removing seed of %s: %v", name, err)
+        }
+        json.NewEncoder(w).Encode(map[string]string{"result": "executed"})
+        return
+
+    case "exec_vm":
+        // Expect { name, command: [string], stdin?, timeout_seconds? }; responds with { exit_code, stdout, stderr }
+        var payload struct {
+            Name           string   `json:"name"`
+            Command        []string `json:"command"`
+            Stdin          *string  `json:"stdin"`
+            TimeoutSeconds int      `json:"timeout_seconds"`
+        }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        if payload.Name == "" || len(payload.Command) == 0 {
+            http.Error(w, "missing name or command", http.StatusBadRequest)
+            return
+        }
+        timeout := 10 * time.Minute
+        if payload.TimeoutSeconds > 0 {
+            timeout = time.Duration(payload.TimeoutSeconds) * time.Second
+        }
+        var stdin []byte
+        if payload.Stdin != nil {
+            stdin = []byte(*payload.Stdin)
+        }
+        res, err := guestExec(payload.Name, payload.Command, stdin, timeout)
+        if err != nil {
+            http.Error(w, fmt.Sprintf("tart exec failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{"result": "executed", "exit_code": res.ExitCode, "stdout": res.Stdout, "stderr": res.Stderr})
+        return
+
+    case "push_vm":
+        // Expect { name, refs: [string], username?, password? }; responds with { digest } of the pushed manifest
+        var payload struct {
+            Name     string   `json:"name"`
+            Refs     []string `json:"refs"`
+            Username string   `json:"username"`
+            Password string   `json:"password"`
+        }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        if payload.Name == "" || len(payload.Refs) == 0 {
+            http.Error(w, "missing name or refs", http.StatusBadRequest)
+            return
+        }
+        // --populate-cache leaves the pushed manifest in the OCI cache, so its digest can be read offline
+        args := append([]string{"--populate-cache", payload.Name}, payload.Refs...)
+        if err := execTartEnv(r.Context(), registryEnv(payload.Username, payload.Password), "push", args...); err != nil {
+            http.Error(w, fmt.Sprintf("tart push failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        digest, err := localImageDigest(payload.Refs[0])
+        if err != nil {
+            log.Printf("reading digest of %s: %v", payload.Refs[0], err)
+        }
+        json.NewEncoder(w).Encode(map[string]string{"result": "executed", "digest": digest})
+        return
+
+    case "rename_vm":
+        // Expect { name, new_name }; the VM keeps its disk, and its seed directory moves along
+        var payload struct {
+            Name    string `json:"name"`
+            NewName string `json:"new_name"`
+        }
+        if err := json.Unmarshal(req.Data, &payload); err != nil {
+            http.Error(w, fmt.Sprintf("invalid data: %v", err), http.StatusBadRequest)
+            return
+        }
+        if payload.Name == "" || payload.NewName == "" {
+            http.Error(w, "missing name or new_name", http.StatusBadRequest)
+            return
+        }
+        if err := execTart("rename", payload.Name, payload.NewName); err != nil {
+            http.Error(w, fmt.Sprintf("tart rename failed: %v", err), http.StatusBadGateway)
+            return
+        }
+        if err := moveSeedDir(payload.Name, payload.NewName); err != nil {
+            log.Printf("moving seed of %s to %s: %v", payload.Name, payload.NewName, err)
+        }
         json.NewEncoder(w).Encode(map[string]string{"result": "executed"})
         return
 
@@ -182,6 +692,101 @@ func execTart(subcmd string, args ...string) error {
     return cmd.Run()
 }
 
+// execTartEnv runs a tart subcommand with extra environment variables; it is
+// killed when ctx is done, e.g. when the controller's request is cancelled.
+func execTartEnv(ctx context.Context, env []string, subcmd string, args ...string) error {
+    if _, err := exec.LookPath("tart"); err != nil {
+        return errors.New("tart binary not found in PATH")
+    }
+    cmd := exec.CommandContext(ctx, "tart", append([]string{subcmd}, args...)...)
+    cmd.Env = append(os.Environ(), env...)
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+    return cmd.Run()
+}
+
+// registryEnv passes registry credentials to tart through TART_REGISTRY_USERNAME
+// and TART_REGISTRY_PASSWORD, which take precedence over the keychain and are never persisted.
+func registryEnv(username, password string) []string {
+    if username == "" || password == "" {
+        return nil
+    }
+    return []string{"TART_REGISTRY_USERNAME=" + username, "TART_REGISTRY_PASSWORD=" + password}
+}
+
+// execTartOutput runs a tart subcommand and returns its stdout.
+func execTartOutput(subcmd string, args ...string) ([]byte, error) {
+    if _, err := exec.LookPath("tart"); err != nil {
+        return nil, errors.New("tart binary not found in PATH")
+    }
+    cmd := exec.Command("tart", append([]string{subcmd}, args...)...)
+    cmd.Stderr = os.Stderr
+    return cmd.Output()
+}
+
+// execTartInput runs a tart subcommand with input on its stdin.
+func execTartInput(input []byte, subcmd string, args ...string) error {
+    if _, err := exec.LookPath("tart"); err != nil {
+        return errors.New("tart binary not found in PATH")
+    }
+    cmd := exec.Command("tart", append([]string{subcmd}, args...)...)
+    cmd.Stdin = bytes.NewReader(input)
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+    return cmd.Run()
+}
+
+// startTartDetached starts a long-running tart subcommand (e.g. run) without waiting for it.
+// The returned channel receives the command's result when it exits.
+func startTartDetached(subcmd string, args ...string) (<-chan error, error) {
+    if _, err := exec.LookPath("tart"); err != nil {
+        return nil, errors.New("tart binary not found in PATH")
+    }
+    cmd := exec.Command("tart", append([]string{subcmd}, args...)...)
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+    if err := cmd.Start(); err != nil {
+        return nil, err
+    }
+    exited := make(chan error, 1)
+    go func() {
+        err := cmd.Wait()
+        if err != nil {
+            log.Printf("tart %s exited: %v", subcmd, err)
+        }
+        exited <- err
+    }()
+    return exited, nil
+}
+
+// vmStartTimeout bounds how long run_vm waits for tart to report a VM as running.
+var vmStartTimeout = time.Minute
+
+// vmStartPollInterval is how often a starting VM's state is checked.
+var vmStartPollInterval = time.Second
+
+// waitUntilRunning polls tart list until the VM is running. It fails if the
+// tart run process reports on exited first or timeout passes.
+func waitUntilRunning(name string, exited <-chan error, timeout time.Duration) error {
+    deadline := time.Now().Add(timeout)
+    for {
+        if vm, err := findLocalVM(name); err == nil && vm.State == "running" {
+            return nil
+        }
+        select {
+        case err := <-exited:
+            if err == nil {
+                err = errors.New("exited before the VM was running")
+            }
+            return err
+        case <-time.After(vmStartPollInterval):
+        }
+        if time.Now().After(deadline) {
+            return fmt.Errorf("vm %s not running after %v", name, timeout)
+        }
+    }
+}
+
 func downloadAndDecompress(url, destName string) (string, error) {
     cacheDir := filepath.Join(os.Getenv("HOME"), ".cache", "tart-images")
     if err := os.MkdirAll(cacheDir, 0o755); err != nil {
@@ -7,6 +7,7 @@ import (
 
 func main() {
 	http.HandleFunc("/execute", handleExecute)
+	http.HandleFunc("/upload", handleUpload)
 	log.Println("Starting Executor Daemon at :9090...")
 	log.Fatal(http.ListenAndServe(":9090", nil))
 }
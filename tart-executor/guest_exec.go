@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// maxExecOutput caps the stdout and stderr kept from a guest command each.
+const maxExecOutput = 1 << 20
+
+// execResult is the outcome of a command run in the guest with `tart exec`.
+type execResult struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest.
+type cappedBuffer struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if room := c.max - c.buf.Len(); room > 0 {
+		if len(p) > room {
+			c.buf.Write(p[:room])
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// guestExec runs command in the named VM through the Tart guest agent. A
+// non-zero exit status is reported in the result, not as an error; errors mean
+// the command could not be run or did not finish within timeout.
+func guestExec(name string, command []string, stdin []byte, timeout time.Duration) (execResult, error) {
+	if _, err := exec.LookPath("tart"); err != nil {
+		return execResult{}, errors.New("tart binary not found in PATH")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	args := []string{"exec"}
+	if stdin != nil {
+		args = append(args, "-i")
+	}
+	args = append(append(args, name), command...)
+	cmd := exec.CommandContext(ctx, "tart", args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	stdout := &cappedBuffer{max: maxExecOutput}
+	stderr := &cappedBuffer{max: maxExecOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	res := execResult{Stdout: stdout.buf.String(), Stderr: stderr.buf.String()}
+	if ctx.Err() == context.DeadlineExceeded {
+		return res, fmt.Errorf("command did not finish within %s", timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
+		return res, nil
+	}
+	return res, err
+}
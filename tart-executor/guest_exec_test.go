@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// echoTart echoes its arguments and stdin and exits with the status given in $FAKE_TART_EXIT.
+const echoTart = "echo \"$@\"\nif [ \"$2\" = \"-i\" ]; then cat; fi\necho oops >&2\nexit ${FAKE_TART_EXIT:-0}\n"
+
+// fakeTart puts a tart on PATH that runs script, a /bin/sh body, in place of Tart.
+func fakeTart(t *testing.T, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tart"), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestExecVM(t *testing.T) {
+	fakeTart(t, echoTart)
+	t.Setenv("FAKE_TART_EXIT", "3")
+
+	rec := executeAction(t, "exec_vm", map[string]interface{}{"name": "vm1", "command": []string{"hostname", "-s"}, "stdin": "hello\n"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("exec_vm: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var res execResult
+	_ = json.Unmarshal(rec.Body.Bytes(), &res)
+	if res.ExitCode != 3 || res.Stdout != "exec -i vm1 hostname -s\nhello\n" || res.Stderr != "oops\n" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	if rec := executeAction(t, "exec_vm", map[string]interface{}{"name": "vm1"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a command, got %d", rec.Code)
+	}
+}
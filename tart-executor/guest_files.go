@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"path"
+	"regexp"
+)
+
+// writeFileScript writes stdin to $1 with mode $2, creating parent directories.
+const writeFileScript = `mkdir -p "$(dirname "$1")" && cat > "$1" && chmod "$2" "$1"`
+
+var fileModePattern = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+// writeGuestFile streams r into dest inside the named VM through `tart exec -i`
+// and returns the SHA-256 and size of what was sent.
+func writeGuestFile(name, dest, mode string, r io.Reader) (string, int64, error) {
+	if _, err := exec.LookPath("tart"); err != nil {
+		return "", 0, errors.New("tart binary not found in PATH")
+	}
+	h := sha256.New()
+	counter := &countingReader{r: io.TeeReader(r, h)}
+	cmd := exec.Command("tart", "exec", "-i", name, "/bin/sh", "-c", writeFileScript, "sh", dest, mode)
+	cmd.Stdin = counter
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", 0, fmt.Errorf("%v: %s", err, out)
+	}
+	return hex.EncodeToString(h.Sum(nil)), counter.n, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// handleUpload serves the write_file action, which streams its request body
+// into the guest instead of carrying it in JSON:
+// PUT /upload?name=<vm>&path=<absolute guest path>&mode=0644
+func handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+	name, dest, mode := q.Get("name"), q.Get("path"), q.Get("mode")
+	if mode == "" {
+		mode = "0644"
+	}
+	if name == "" || dest == "" {
+		http.Error(w, "missing name or path", http.StatusBadRequest)
+		return
+	}
+	if !path.IsAbs(dest) || path.Clean(dest) != dest {
+		http.Error(w, "path must be absolute and clean", http.StatusBadRequest)
+		return
+	}
+	if !fileModePattern.MatchString(mode) {
+		http.Error(w, "mode must be octal, e.g. 0644", http.StatusBadRequest)
+		return
+	}
+	sum, size, err := writeGuestFile(name, dest, mode, r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("tart exec failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": "executed", "sha256": sum, "size": size})
+}
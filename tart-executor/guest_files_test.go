@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleUpload(t *testing.T) {
+	// The fake tart runs the guest script locally, with the VM name dropped
+	fakeTart(t, "shift 3\nexec \"$@\"\n")
+	dest := filepath.Join(t.TempDir(), "etc", "license.txt")
+
+	rec := httptest.NewRecorder()
+	handleUpload(rec, httptest.NewRequest(http.MethodPut, "/upload?name=vm1&mode=0600&path="+dest, strings.NewReader("licensed\n")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var res struct {
+		SHA256 string `json:"sha256"`
+		Size   int64  `json:"size"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &res)
+	if res.Size != 9 || res.SHA256 != "f164ff5293fdd0723780a25768a6d8e0fc21b2197b0814d36a8137c7bb18c5d2" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil || string(got) != "licensed\n" {
+		t.Fatalf("expected file written, got %q (%v)", got, err)
+	}
+	if fi, _ := os.Stat(dest); fi.Mode().Perm() != 0o600 {
+		t.Fatalf("expected mode 0600, got %v", fi.Mode().Perm())
+	}
+
+	for _, q := range []string{"name=vm1&path=relative.txt", "name=vm1&path=/etc/x&mode=abc", "path=/etc/x"} {
+		rec := httptest.NewRecorder()
+		handleUpload(rec, httptest.NewRequest(http.MethodPut, "/upload?"+q, strings.NewReader("x")))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", q, rec.Code)
+		}
+	}
+}
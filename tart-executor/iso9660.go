@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// isoSector is the ISO9660 logical block size.
+const isoSector = 2048
+
+// isoFile is one file placed in the root directory of a generated image.
+type isoFile struct {
+	Name string // long name, exposed through Joliet (e.g. "user-data")
+	Data []byte
+}
+
+// Fixed layout of the images we generate: everything lives in the root directory,
+// so each tree needs exactly one directory sector and one path table sector.
+const (
+	isoPVDSector         = 16
+	isoSVDSector         = 17
+	isoTerminatorSector  = 18
+	isoPathLSector       = 19
+	isoPathMSector       = 20
+	isoJolietPathLSector = 21
+	isoJolietPathMSector = 22
+	isoRootSector        = 23
+	isoJolietRootSector  = 24
+	isoFirstDataSector   = 25
+)
+
+// writeISO9660 writes a single-directory ISO9660 image with Joliet extensions. Primary
+// names are upper-cased 8.3 variants; Joliet carries the real names so Linux guests
+// (and cloud-init's NoCloud datasource) see "user-data", "meta-data", etc.
+func writeISO9660(w io.Writer, volumeID string, files []isoFile, now time.Time) error {
+	files = append([]isoFile(nil), files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	extents := make([]uint32, len(files))
+	next := uint32(isoFirstDataSector)
+	for i, f := range files {
+		extents[i] = next
+		next += uint32((len(f.Data) + isoSector - 1) / isoSector)
+	}
+	totalSectors := next
+
+	primaryNames := make([][]byte, len(files))
+	jolietNames := make([][]byte, len(files))
+	seen := map[string]bool{}
+	for i, f := range files {
+		pn := primaryName(f.Name)
+		if seen[pn] {
+			return fmt.Errorf("file names %q collide as %s", f.Name, pn)
+		}
+		seen[pn] = true
+		primaryNames[i] = []byte(pn)
+		jolietNames[i] = ucs2(f.Name)
+	}
+
+	primaryDir, err := isoDirectory(isoRootSector, primaryNames, files, extents, now)
+	if err != nil {
+		return err
+	}
+	jolietDir, err := isoDirectory(isoJolietRootSector, jolietNames, files, extents, now)
+	if err != nil {
+		return err
+	}
+
+	img := make([]byte, int(isoFirstDataSector)*isoSector)
+	put := func(sector int, b []byte) { copy(img[sector*isoSector:], b) }
+
+	put(isoPVDSector, volumeDescriptor(1, volumeID, totalSectors, isoPathLSector, isoPathMSector, isoRootSector, now))
+	put(isoSVDSector, volumeDescriptor(2, volumeID, totalSectors, isoJolietPathLSector, isoJolietPathMSector, isoJolietRootSector, now))
+	term := make([]byte, 7)
+	term[0] = 255
+	copy(term[1:], "CD001")
+	term[6] = 1
+	put(isoTerminatorSector, term)
+	put(isoPathLSector, rootPathTable(isoRootSector, binary.LittleEndian))
+	put(isoPathMSector, rootPathTable(isoRootSector, binary.BigEndian))
+	put(isoJolietPathLSector, rootPathTable(isoJolietRootSector, binary.LittleEndian))
+	put(isoJolietPathMSector, rootPathTable(isoJolietRootSector, binary.BigEndian))
+	put(isoRootSector, primaryDir)
+	put(isoJolietRootSector, jolietDir)
+
+	if _, err := w.Write(img); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if len(f.Data) == 0 {
+			continue
+		}
+		padded := make([]byte, (len(f.Data)+isoSector-1)/isoSector*isoSector)
+		copy(padded, f.Data)
+		if _, err := w.Write(padded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// primaryName maps a long name to an ISO9660 level 1 identifier such as "USER_DAT.;1".
+func primaryName(name string) string {
+	base, ext := name, ""
+	if i := strings.LastIndex(name, "."); i > 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	clean := func(s string, max int) string {
+		var b strings.Builder
+		for _, r := range strings.ToUpper(s) {
+			if b.Len() == max {
+				break
+			}
+			if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				b.WriteRune(r)
+			} else {
+				b.WriteByte('_')
+			}
+		}
+		return b.String()
+	}
+	return clean(base, 8) + "." + clean(ext, 3) + ";1"
+}
+
+// ucs2 encodes s as big-endian UCS-2, as Joliet requires.
+func ucs2(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.BigEndian.PutUint16(out[2*i:], u)
+	}
+	return out
+}
+
+func bothEndian32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b, v)
+	binary.BigEndian.PutUint32(b[4:], v)
+}
+
+func bothEndian16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b, v)
+	binary.BigEndian.PutUint16(b[2:], v)
+}
+
+// dirRecord encodes an ISO9660 directory record.
+func dirRecord(name []byte, extent, size uint32, isDir bool, now time.Time) []byte {
+	n := 33 + len(name)
+	if n%2 == 1 {
+		n++
+	}
+	rec := make([]byte, n)
+	rec[0] = byte(n)
+	bothEndian32(rec[2:], extent)
+	bothEndian32(rec[10:], size)
+	t := now.UTC()
+	rec[18] = byte(t.Year() - 1900)
+	rec[19] = byte(t.Month())
+	rec[20] = byte(t.Day())
+	rec[21] = byte(t.Hour())
+	rec[22] = byte(t.Minute())
+	rec[23] = byte(t.Second())
+	if isDir {
+		rec[25] = 2
+	}
+	bothEndian16(rec[28:], 1)
+	rec[32] = byte(len(name))
+	copy(rec[33:], name)
+	return rec
+}
+
+// isoDirectory builds the single root directory sector of one tree.
+func isoDirectory(self uint32, names [][]byte, files []isoFile, extents []uint32, now time.Time) ([]byte, error) {
+	dir := make([]byte, 0, isoSector)
+	dir = append(dir, dirRecord([]byte{0}, self, isoSector, true, now)...)
+	dir = append(dir, dirRecord([]byte{1}, self, isoSector, true, now)...)
+	for i, f := range files {
+		dir = append(dir, dirRecord(names[i], extents[i], uint32(len(f.Data)), false, now)...)
+	}
+	if len(dir) > isoSector {
+		return nil, fmt.Errorf("too many files for a single directory sector")
+	}
+	return dir, nil
+}
+
+func rootPathTable(rootSector uint32, order binary.ByteOrder) []byte {
+	pt := make([]byte, 10)
+	pt[0] = 1 // identifier length
+	order.PutUint32(pt[2:], rootSector)
+	order.PutUint16(pt[6:], 1) // parent directory number
+	return pt
+}
+
+// isoDate encodes a 17-byte volume descriptor timestamp.
+func isoDate(t time.Time) []byte {
+	b := []byte(t.UTC().Format("20060102150405") + "00")
+	return append(b, 0)
+}
+
+// volumeDescriptor builds the primary (kind 1) or Joliet supplementary (kind 2) descriptor.
+func volumeDescriptor(kind byte, volumeID string, totalSectors, pathL, pathM, root uint32, now time.Time) []byte {
+	vd := make([]byte, isoSector)
+	vd[0] = kind
+	copy(vd[1:], "CD001")
+	vd[6] = 1
+	text := func(off, size int, s string) {
+		field := vd[off : off+size]
+		if kind == 2 {
+			for i := 0; i+1 < size; i += 2 {
+				field[i], field[i+1] = 0x00, ' '
+			}
+			copy(field, ucs2(s))
+			return
+		}
+		for i := range field {
+			field[i] = ' '
+		}
+		copy(field, s)
+	}
+	text(8, 32, "")
+	text(40, 32, volumeID)
+	bothEndian32(vd[80:], totalSectors)
+	if kind == 2 {
+		copy(vd[88:], "%/E") // UCS-2 level 3
+	}
+	bothEndian16(vd[120:], 1)
+	bothEndian16(vd[124:], 1)
+	bothEndian16(vd[128:], isoSector)
+	bothEndian32(vd[132:], 10)
+	binary.LittleEndian.PutUint32(vd[140:], pathL)
+	binary.BigEndian.PutUint32(vd[148:], pathM)
+	copy(vd[156:], dirRecord([]byte{0}, root, isoSector, true, now))
+	for _, f := range [][2]int{{190, 128}, {318, 128}, {446, 128}, {574, 128}, {702, 37}, {739, 37}, {776, 37}} {
+		text(f[0], f[1], "")
+	}
+	date := isoDate(now)
+	copy(vd[813:], date)
+	copy(vd[830:], date)
+	copy(vd[847:], "0000000000000000")
+	copy(vd[864:], date)
+	vd[881] = 1
+	return vd
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// readISORoot walks the root directory referenced by the volume descriptor in the
+// given sector and returns file name -> contents, decoding Joliet names when asked.
+func readISORoot(t *testing.T, img []byte, vdSector int, joliet bool) map[string]string {
+	t.Helper()
+	vd := img[vdSector*isoSector:]
+	root := vd[156:]
+	extent := binary.LittleEndian.Uint32(root[2:])
+	dir := img[int(extent)*isoSector : int(extent+1)*isoSector]
+	files := map[string]string{}
+	for off := 0; off < len(dir) && dir[off] != 0; off += int(dir[off]) {
+		rec := dir[off:]
+		nameLen := int(rec[32])
+		name := rec[33 : 33+nameLen]
+		if rec[25]&2 != 0 {
+			continue // "." and ".."
+		}
+		var decoded string
+		if joliet {
+			units := make([]uint16, nameLen/2)
+			for i := range units {
+				units[i] = binary.BigEndian.Uint16(name[2*i:])
+			}
+			decoded = string(utf16.Decode(units))
+		} else {
+			decoded = string(name)
+		}
+		start := int(binary.LittleEndian.Uint32(rec[2:])) * isoSector
+		size := int(binary.LittleEndian.Uint32(rec[10:]))
+		files[decoded] = string(img[start : start+size])
+	}
+	return files
+}
+
+func TestWriteISO9660_NoCloudSeed(t *testing.T) {
+	userData := "#cloud-config\nhostname: build-01\n"
+	metaData := "instance-id: build-01\nlocal-hostname: build-01\n"
+	var buf bytes.Buffer
+	err := writeISO9660(&buf, "cidata", []isoFile{
+		{Name: "user-data", Data: []byte(userData)},
+		{Name: "meta-data", Data: []byte(metaData)},
+		{Name: "network-config", Data: nil},
+	}, time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("writeISO9660 failed: %v", err)
+	}
+	img := buf.Bytes()
+	if len(img)%isoSector != 0 {
+		t.Fatalf("image size %d is not a multiple of the sector size", len(img))
+	}
+	if string(img[isoPVDSector*isoSector+1:isoPVDSector*isoSector+6]) != "CD001" {
+		t.Fatalf("missing primary volume descriptor")
+	}
+	if got := string(bytes.TrimRight(img[isoPVDSector*isoSector+40:isoPVDSector*isoSector+72], " ")); got != "cidata" {
+		t.Fatalf("expected volume id cidata, got %q", got)
+	}
+	if string(img[isoSVDSector*isoSector+88:isoSVDSector*isoSector+91]) != "%/E" {
+		t.Fatalf("missing Joliet escape sequence")
+	}
+	if img[isoTerminatorSector*isoSector] != 255 {
+		t.Fatalf("missing volume descriptor set terminator")
+	}
+	sectors := binary.LittleEndian.Uint32(img[isoPVDSector*isoSector+80:])
+	if int(sectors)*isoSector != len(img) {
+		t.Fatalf("volume space size %d does not match image length %d", sectors, len(img))
+	}
+
+	joliet := readISORoot(t, img, isoSVDSector, true)
+	if joliet["user-data"] != userData || joliet["meta-data"] != metaData {
+		t.Fatalf("unexpected Joliet contents: %v", joliet)
+	}
+	if v, ok := joliet["network-config"]; !ok || v != "" {
+		t.Fatalf("expected empty network-config entry, got %q (present=%v)", v, ok)
+	}
+	primary := readISORoot(t, img, isoPVDSector, false)
+	if primary["USER_DAT.;1"] != userData {
+		t.Fatalf("unexpected primary contents: %v", primary)
+	}
+}
+
+func TestPrimaryName(t *testing.T) {
+	cases := map[string]string{
+		"user-data":      "USER_DAT.;1",
+		"network-config": "NETWORK_.;1",
+		"readme.txt":     "README.TXT;1",
+	}
+	for in, want := range cases {
+		if got := primaryName(in); got != want {
+			t.Errorf("primaryName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
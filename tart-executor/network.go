@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// vmNetwork mirrors the controller's network settings in run_vm payloads.
+type vmNetwork struct {
+	Mode          string   `json:"mode"`
+	Interface     string   `json:"interface"`
+	SoftnetAllow  []string `json:"softnet_allow"`
+	SoftnetExpose []string `json:"softnet_expose"`
+}
+
+// netArgs translates a network mode into `tart run` flags; NAT is Tart's default and needs none.
+func netArgs(n *vmNetwork) []string {
+	if n == nil {
+		return nil
+	}
+	switch n.Mode {
+	case "bridged":
+		return []string{"--net-bridged", n.Interface}
+	case "softnet":
+		args := []string{"--net-softnet"}
+		if len(n.SoftnetAllow) > 0 {
+			args = append(args, "--net-softnet-allow", strings.Join(n.SoftnetAllow, ","))
+		}
+		if len(n.SoftnetExpose) > 0 {
+			args = append(args, "--net-softnet-expose", strings.Join(n.SoftnetExpose, ","))
+		}
+		return args
+	case "host":
+		return []string{"--net-host"}
+	}
+	return nil
+}
+
+// hostInterface is a network interface VMs can be bridged to.
+type hostInterface struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// listHostInterfaces reports the host's hardware ports (`networksetup -listallhardwareports`),
+// which are the interfaces Virtualization.framework can bridge to.
+func listHostInterfaces() ([]hostInterface, error) {
+	if _, err := exec.LookPath("networksetup"); err != nil {
+		return nil, errors.New("networksetup not found in PATH")
+	}
+	out, err := exec.Command("networksetup", "-listallhardwareports").Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseHardwarePorts(out), nil
+}
+
+// parseHardwarePorts reads "Hardware Port: Wi-Fi" / "Device: en0" pairs.
+func parseHardwarePorts(out []byte) []hostInterface {
+	ifaces := []hostInterface{}
+	var port string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if v, ok := strings.CutPrefix(line, "Hardware Port: "); ok {
+			port = v
+		} else if v, ok := strings.CutPrefix(line, "Device: "); ok && port != "" {
+			ifaces = append(ifaces, hostInterface{Name: v, DisplayName: port})
+			port = ""
+		}
+	}
+	return ifaces
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetArgs(t *testing.T) {
+	cases := []struct {
+		net  *vmNetwork
+		want []string
+	}{
+		{nil, nil},
+		{&vmNetwork{Mode: "nat"}, nil},
+		{&vmNetwork{Mode: "bridged", Interface: "en0"}, []string{"--net-bridged", "en0"}},
+		{&vmNetwork{Mode: "host"}, []string{"--net-host"}},
+		{&vmNetwork{Mode: "softnet"}, []string{"--net-softnet"}},
+		{
+			&vmNetwork{Mode: "softnet", SoftnetAllow: []string{"10.0.0.0/8", "192.168.1.0/24"}, SoftnetExpose: []string{"2222:22"}},
+			[]string{"--net-softnet", "--net-softnet-allow", "10.0.0.0/8,192.168.1.0/24", "--net-softnet-expose", "2222:22"},
+		},
+	}
+	for _, c := range cases {
+		if got := netArgs(c.net); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("netArgs(%+v) = %v, want %v", c.net, got, c.want)
+		}
+	}
+}
+
+func TestParseHardwarePorts(t *testing.T) {
+	out := []byte(`
+Hardware Port: Ethernet
+Device: en0
+Ethernet Address: 3c:a6:f6:00:00:01
+
+Hardware Port: Wi-Fi
+Device: en1
+Ethernet Address: 3c:a6:f6:00:00:02
+
+VLAN Configurations
+===================
+`)
+	want := []hostInterface{{Name: "en0", DisplayName: "Ethernet"}, {Name: "en1", DisplayName: "Wi-Fi"}}
+	if got := parseHardwarePorts(out); !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseHardwarePorts = %+v, want %+v", got, want)
+	}
+}
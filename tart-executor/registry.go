@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// imageRef is a parsed OCI reference such as ghcr.io/cirruslabs/ubuntu:latest.
+type imageRef struct {
+	Host       string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// reference returns the tag or digest used to address the manifest.
+func (r imageRef) reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// parseImageRef splits an OCI reference into host, repository and tag/digest.
+// Tart always needs a registry host, so references without one are rejected.
+func parseImageRef(ref string) (imageRef, error) {
+	var out imageRef
+	rest := ref
+	if i := strings.Index(rest, "@"); i >= 0 {
+		out.Digest = rest[i+1:]
+		rest = rest[:i]
+	}
+	slash := strings.Index(rest, "/")
+	if slash <= 0 {
+		return imageRef{}, fmt.Errorf("reference %q has no registry host", ref)
+	}
+	out.Host = rest[:slash]
+	if !strings.ContainsAny(out.Host, ".:") && out.Host != "localhost" {
+		return imageRef{}, fmt.Errorf("reference %q has no registry host", ref)
+	}
+	rest = rest[slash+1:]
+	if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.Contains(rest[i:], "/") {
+		out.Tag = rest[i+1:]
+		rest = rest[:i]
+	}
+	if rest == "" {
+		return imageRef{}, fmt.Errorf("reference %q has no repository", ref)
+	}
+	out.Repository = rest
+	if out.Tag == "" && out.Digest == "" {
+		out.Tag = "latest"
+	}
+	return out, nil
+}
+
+// manifestAccept lists the manifest media types Tart images are published with.
+var manifestAccept = strings.Join([]string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+// resolveRemoteDigest asks the registry which manifest digest the reference currently points to.
+// It performs the bearer-token dance used by GHCR and most OCI registries, anonymously unless
+// username and password are given; registries that challenge with Basic get them directly.
+func resolveRemoteDigest(client *http.Client, scheme, ref, username, password string) (string, error) {
+	r, err := parseImageRef(ref)
+	if err != nil {
+		return "", err
+	}
+	if r.Digest != "" {
+		return r.Digest, nil
+	}
+	manifestURL := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, r.Host, r.Repository, r.reference())
+	resp, err := headManifest(client, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		var authorization string
+		if strings.HasPrefix(challenge, "Basic ") && username != "" {
+			authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+		} else {
+			token, err := fetchRegistryToken(client, challenge, username, password)
+			if err != nil {
+				return "", err
+			}
+			authorization = "Bearer " + token
+		}
+		if resp, err = headManifest(client, manifestURL, authorization); err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry manifest status: %s", resp.Status)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", errors.New("registry did not return a manifest digest")
+	}
+	return digest, nil
+}
+
+// headManifest requests the manifest's headers, sending authorization as the Authorization header when set.
+func headManifest(client *http.Client, manifestURL, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", manifestAccept)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// fetchRegistryToken requests a pull token from the realm named in a
+// `WWW-Authenticate: Bearer realm="...",service="...",scope="..."` challenge,
+// authenticating with username and password when given and anonymously otherwise.
+func fetchRegistryToken(client *http.Client, challenge, username, password string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unsupported registry auth challenge %q", challenge)
+	}
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	realm := params["realm"]
+	if realm == "" {
+		return "", errors.New("registry auth challenge has no realm")
+	}
+	q := url.Values{}
+	if s := params["service"]; s != "" {
+		q.Set("service", s)
+	}
+	if s := params["scope"]; s != "" {
+		q.Set("scope", s)
+	}
+	req, err := http.NewRequest(http.MethodGet, realm+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token status: %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// tartHome returns Tart's data directory ($TART_HOME or ~/.tart).
+func tartHome() string {
+	if h := os.Getenv("TART_HOME"); h != "" {
+		return h
+	}
+	return filepath.Join(os.Getenv("HOME"), ".tart")
+}
+
+// localImageDigest returns the digest of the cached OCI image for ref. Tart keeps
+// tag entries as symlinks to sha256:<hex> directories under cache/OCIs.
+func localImageDigest(ref string) (string, error) {
+	r, err := parseImageRef(ref)
+	if err != nil {
+		return "", err
+	}
+	if r.Digest != "" {
+		return r.Digest, nil
+	}
+	link := filepath.Join(tartHome(), "cache", "OCIs", r.Host, filepath.FromSlash(r.Repository), r.Tag)
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(target), nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseImageRef(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    imageRef
+		wantErr bool
+	}{
+		{in: "ghcr.io/cirruslabs/ubuntu:latest", want: imageRef{Host: "ghcr.io", Repository: "cirruslabs/ubuntu", Tag: "latest"}},
+		{in: "ghcr.io/cirruslabs/ubuntu", want: imageRef{Host: "ghcr.io", Repository: "cirruslabs/ubuntu", Tag: "latest"}},
+		{in: "localhost:5000/img:1.0", want: imageRef{Host: "localhost:5000", Repository: "img", Tag: "1.0"}},
+		{in: "ghcr.io/org/img@sha256:abc", want: imageRef{Host: "ghcr.io", Repository: "org/img", Digest: "sha256:abc"}},
+		{in: "sequoia-base", wantErr: true},
+		{in: "org/img:tag", wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := parseImageRef(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseImageRef(%q): expected error", tc.in)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseImageRef(%q) = %+v, %v; want %+v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestResolveRemoteDigest_TokenChallenge(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if r.URL.Query().Get("scope") != "repository:org/img:pull" {
+				t.Errorf("unexpected scope %q", r.URL.Query().Get("scope"))
+			}
+			_, _ = w.Write([]byte(`{"token":"anon"}`))
+		case strings.HasPrefix(r.URL.Path, "/v2/org/img/manifests/"):
+			if r.Header.Get("Authorization") != "Bearer anon" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test",scope="repository:org/img:pull"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:feed")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	digest, err := resolveRemoteDigest(srv.Client(), "http", host+"/org/img:latest", "", "")
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if digest != "sha256:feed" {
+		t.Fatalf("expected sha256:feed, got %q", digest)
+	}
+}
+
+// Private repositories only hand out a token for the registry credentials.
+func TestResolveRemoteDigest_PrivateRegistry(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "bot" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"token":"private"}`))
+		case strings.HasPrefix(r.URL.Path, "/v2/org/private/manifests/"):
+			if r.Header.Get("Authorization") != "Bearer private" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test",scope="repository:org/private:pull"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:cafe")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/org/private:latest"
+	if _, err := resolveRemoteDigest(srv.Client(), "http", ref, "", ""); err == nil {
+		t.Fatalf("expected an anonymous lookup to fail")
+	}
+	digest, err := resolveRemoteDigest(srv.Client(), "http", ref, "bot", "secret")
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if digest != "sha256:cafe" {
+		t.Fatalf("expected sha256:cafe, got %q", digest)
+	}
+}
+
+func TestLocalImageDigest(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("TART_HOME", home)
+	dir := filepath.Join(home, "cache", "OCIs", "ghcr.io", "org", "img")
+	if err := os.MkdirAll(filepath.Join(dir, "sha256:beef"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "sha256:beef"), filepath.Join(dir, "latest")); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := localImageDigest("ghcr.io/org/img:latest")
+	if err != nil {
+		t.Fatalf("localImageDigest failed: %v", err)
+	}
+	if digest != "sha256:beef" {
+		t.Fatalf("expected sha256:beef, got %q", digest)
+	}
+}
+
+func TestPullImage_RegistryCredentials(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "env")
+	fakeTart(t, "env | grep '^TART_REGISTRY_' > "+envFile+"\nexit 0\n")
+
+	rec := executeAction(t, "pull_image", map[string]string{"ref": "ghcr.io/acme/private:latest", "username": "ci", "password": "s3cret"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("pull_image: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	env, _ := os.ReadFile(envFile)
+	if !strings.Contains(string(env), "TART_REGISTRY_USERNAME=ci\n") || !strings.Contains(string(env), "TART_REGISTRY_PASSWORD=s3cret\n") {
+		t.Fatalf("expected credentials in tart's environment, got %q", env)
+	}
+
+	if rec := executeAction(t, "pull_image", map[string]string{"ref": "ghcr.io/acme/public:latest"}); rec.Code != http.StatusOK {
+		t.Fatalf("pull_image: expected 200, got %d", rec.Code)
+	}
+	if env, _ := os.ReadFile(envFile); len(env) != 0 {
+		t.Fatalf("expected no credentials for an anonymous pull, got %q", env)
+	}
+}
+
+func TestPushVM(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("TART_HOME", home)
+	argsFile := filepath.Join(t.TempDir(), "args")
+	// The fake tart records its arguments and caches the pushed tag the way Tart does
+	fakeTart(t, "echo \"$@\" > "+argsFile+"\n"+
+		"mkdir -p "+home+"/cache/OCIs/ghcr.io/acme/golden/sha256:abc\n"+
+		"ln -s "+home+"/cache/OCIs/ghcr.io/acme/golden/sha256:abc "+home+"/cache/OCIs/ghcr.io/acme/golden/v1\n")
+
+	rec := executeAction(t, "push_vm", map[string]interface{}{"name": "golden", "refs": []string{"ghcr.io/acme/golden:v1", "ghcr.io/acme/golden:latest"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("push_vm: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"digest":"sha256:abc"`) {
+		t.Fatalf("expected the cached digest, got %s", rec.Body.String())
+	}
+	args, _ := os.ReadFile(argsFile)
+	if string(args) != "push --populate-cache golden ghcr.io/acme/golden:v1 ghcr.io/acme/golden:latest\n" {
+		t.Fatalf("unexpected tart arguments %q", args)
+	}
+}
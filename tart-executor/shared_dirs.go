@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// sharedDir mirrors the controller's shared directory entries in run_vm payloads.
+type sharedDir struct {
+	Name     string `json:"name"`
+	HostPath string `json:"host_path"`
+	ReadOnly bool   `json:"read_only"`
+	Tag      string `json:"tag"`
+}
+
+// dirArg renders a share as the value of `tart run --dir`: name:path[:ro,tag=...].
+func dirArg(d sharedDir) string {
+	arg := d.Name + ":" + d.HostPath
+	var opts []string
+	if d.ReadOnly {
+		opts = append(opts, "ro")
+	}
+	if d.Tag != "" {
+		opts = append(opts, "tag="+d.Tag)
+	}
+	if len(opts) > 0 {
+		arg += ":" + strings.Join(opts, ",")
+	}
+	return arg
+}
+
+// sharedDirNotAllowedError marks host paths whose real location is outside the allowlist.
+type sharedDirNotAllowedError struct{ path string }
+
+func (e sharedDirNotAllowedError) Error() string {
+	return fmt.Sprintf("host_path %q is not in the shared directory allowlist", e.path)
+}
+
+// resolveSharedDirs replaces every host path with its real path on this host
+// and checks it against the controller's allowlist, whose roots are resolved
+// the same way. The controller only compares the paths as written, so a
+// symlink inside an allowed root could otherwise share any directory.
+func resolveSharedDirs(dirs []sharedDir, allowlist []string) ([]sharedDir, error) {
+	var roots []string
+	for _, root := range allowlist {
+		// A root that does not exist on this host allows nothing
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			roots = append(roots, real)
+		}
+	}
+	resolved := make([]sharedDir, 0, len(dirs))
+	for _, d := range dirs {
+		real, err := filepath.EvalSymlinks(d.HostPath)
+		if err != nil {
+			return nil, fmt.Errorf("host_path %q: %w", d.HostPath, err)
+		}
+		if !pathAllowed(real, roots) {
+			return nil, sharedDirNotAllowedError{d.HostPath}
+		}
+		if strings.ContainsAny(real, ":,") {
+			return nil, fmt.Errorf("host_path %q resolves to %q, which contains ':' or ','", d.HostPath, real)
+		}
+		d.HostPath = real
+		resolved = append(resolved, d)
+	}
+	return resolved, nil
+}
+
+func pathAllowed(p string, allowlist []string) bool {
+	for _, root := range allowlist {
+		if p == root || strings.HasPrefix(p, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
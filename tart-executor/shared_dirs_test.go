@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirArg(t *testing.T) {
+	cases := []struct {
+		dir  sharedDir
+		want string
+	}{
+		{sharedDir{Name: "cache", HostPath: "/Volumes/cache"}, "cache:/Volumes/cache"},
+		{sharedDir{Name: "cache", HostPath: "/Volumes/cache", ReadOnly: true}, "cache:/Volumes/cache:ro"},
+		{sharedDir{Name: "src", HostPath: "/Users/ci/src", ReadOnly: true, Tag: "build"}, "src:/Users/ci/src:ro,tag=build"},
+		{sharedDir{Name: "out", HostPath: "/Users/ci/out", Tag: "build"}, "out:/Users/ci/out:tag=build"},
+	}
+	for _, c := range cases {
+		if got := dirArg(c.dir); got != c.want {
+			t.Errorf("dirArg(%+v) = %q, want %q", c.dir, got, c.want)
+		}
+	}
+}
+
+func TestResolveSharedDirs(t *testing.T) {
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed := filepath.Join(base, "allowed")
+	secret := filepath.Join(base, "secret")
+	for _, d := range []string{filepath.Join(allowed, "src"), secret} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A link out of the allowed root, and an allowlist entry that is itself a link
+	if err := os.Symlink(secret, filepath.Join(allowed, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(allowed, filepath.Join(base, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	allowlist := []string{filepath.Join(base, "alias")}
+
+	dirs, err := resolveSharedDirs([]sharedDir{{Name: "src", HostPath: filepath.Join(base, "alias", "src"), ReadOnly: true}}, allowlist)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dirs) != 1 || dirs[0].HostPath != filepath.Join(allowed, "src") || !dirs[0].ReadOnly {
+		t.Fatalf("expected the real path to be shared, got %+v", dirs)
+	}
+
+	var denied sharedDirNotAllowedError
+	if _, err := resolveSharedDirs([]sharedDir{{Name: "x", HostPath: filepath.Join(allowed, "escape")}}, allowlist); !errors.As(err, &denied) {
+		t.Fatalf("expected a symlink out of the allowlist to be denied, got %v", err)
+	}
+	if _, err := resolveSharedDirs([]sharedDir{{Name: "x", HostPath: filepath.Join(allowed, "missing")}}, allowlist); err == nil || errors.As(err, &denied) {
+		t.Fatalf("expected a missing host path to be an error, got %v", err)
+	}
+	if rec := executeAction(t, "run_vm", map[string]interface{}{
+		"name": "vm1", "dirs": []sharedDir{{Name: "x", HostPath: filepath.Join(allowed, "escape")}}, "allowlist": allowlist,
+	}); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected run_vm to refuse the share with 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// installKeysScript appends stdin to the guest user's authorized_keys.
+const installKeysScript = `mkdir -p ~/.ssh && chmod 700 ~/.ssh && cat >> ~/.ssh/authorized_keys && chmod 600 ~/.ssh/authorized_keys`
+
+// pendingKeysPath holds SSH keys waiting to be installed through the guest
+// agent; macOS guests have no cloud-init to pick them up from the seed.
+func pendingKeysPath(name string) string {
+	return filepath.Join(seedDir(name), "authorized_keys")
+}
+
+func writePendingSSHKeys(name string, keys []string) error {
+	if err := os.MkdirAll(seedDir(name), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(pendingKeysPath(name), []byte(strings.Join(keys, "\n")+"\n"), 0o600)
+}
+
+// installPendingSSHKeys pushes pending keys into a running VM with `tart exec`,
+// retrying until the guest agent answers or timeout passes. The pending file
+// is removed once the keys are in place, so later runs skip this.
+func installPendingSSHKeys(name string, timeout time.Duration) error {
+	keys, err := os.ReadFile(pendingKeysPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		err = execTartInput(keys, "exec", "-i", name, "/bin/sh", "-c", installKeysScript)
+		if err == nil {
+			return os.Remove(pendingKeysPath(name))
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		log.Printf("installing SSH keys on %s: %v, retrying", name, err)
+		time.Sleep(5 * time.Second)
+	}
+}
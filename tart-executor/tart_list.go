@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/beleganjur/terraform-provider-tart/internal/tartlist"
+)
+
+// imageInfo is the executor's view of one image for list_images.
+type imageInfo struct {
+	Name         string `json:"name"`
+	Source       string `json:"source"`
+	DiskGB       int    `json:"disk_gb"`
+	SizeGB       int    `json:"size_gb"`
+	LastAccessed string `json:"last_accessed,omitempty"`
+	State        string `json:"state"`
+}
+
+// toImageInfos normalizes tart list entries into images, lower-casing the source (local/oci).
+func toImageInfos(entries []tartlist.Entry) []imageInfo {
+	images := make([]imageInfo, 0, len(entries))
+	for _, e := range entries {
+		images = append(images, imageInfo{
+			Name:         e.Name,
+			Source:       strings.ToLower(e.Source),
+			DiskGB:       e.Disk,
+			SizeGB:       e.Size,
+			LastAccessed: imageAccessTime(e),
+			State:        e.State,
+		})
+	}
+	return images
+}
+
+// imageAccessTime returns the RFC 3339 mtime of the image's directory under tartHome().
+// tart list only reports Accessed as a relative string ("2 days ago"), which cannot be
+// ordered, so the bundle directory is the closest real timestamp. Empty when it is missing.
+func imageAccessTime(e tartlist.Entry) string {
+	var dir string
+	if strings.EqualFold(e.Source, "oci") {
+		r, err := parseImageRef(e.Name)
+		if err != nil {
+			return ""
+		}
+		ref := r.Tag
+		if r.Digest != "" {
+			ref = r.Digest
+		}
+		dir = filepath.Join(tartHome(), "cache", "OCIs", r.Host, filepath.FromSlash(r.Repository), ref)
+	} else {
+		dir = filepath.Join(tartHome(), "vms", e.Name)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return ""
+	}
+	return info.ModTime().UTC().Format(time.RFC3339)
+}
+
+// listTartVMs runs `tart list --format json` and returns the parsed entries.
+func listTartVMs() ([]tartlist.Entry, error) {
+	out, err := execTartOutput("list", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	return tartlist.Parse(out)
+}
+
+// errVMNotFound is returned by findLocalVM when tart list has no local VM of that name.
+var errVMNotFound = errors.New("vm not found")
+
+// findLocalVM returns the local (non-OCI) entry with the given name.
+func findLocalVM(name string) (*tartlist.Entry, error) {
+	entries, err := listTartVMs()
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if entries[i].Source == "local" && entries[i].Name == name {
+			return &entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("vm %q: %w", name, errVMNotFound)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/beleganjur/terraform-provider-tart/internal/tartlist"
+)
+
+func TestToImageInfos(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("TART_HOME", home)
+	vmDir := filepath.Join(home, "vms", "sequoia-base")
+	if err := os.MkdirAll(vmDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	accessed := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(vmDir, accessed, accessed); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []tartlist.Entry{
+		{Source: "local", Name: "sequoia-base", Disk: 50, Size: 22, Accessed: "2 days ago", State: "stopped"},
+		{Source: "OCI", Name: "ghcr.io/cirruslabs/ubuntu:latest", Disk: 20, Size: 4, Accessed: "5 minutes ago", State: "stopped"},
+	}
+	images := toImageInfos(entries)
+	if len(images) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(images))
+	}
+	if images[1].Source != "oci" {
+		t.Errorf("expected lower-cased source oci, got %q", images[1].Source)
+	}
+	if images[0].SizeGB != 22 || images[0].LastAccessed != "2026-01-02T10:00:00Z" {
+		t.Errorf("expected the VM directory mtime, got %+v", images[0])
+	}
+	if images[1].LastAccessed != "" {
+		t.Errorf("expected no timestamp for an image missing from the cache, got %q", images[1].LastAccessed)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// vmConfigPath returns the config.json Tart keeps for a local VM.
+func vmConfigPath(name string) string {
+	return filepath.Join(tartHome(), "vms", name, "config.json")
+}
+
+// vmConfig holds the config.json fields the executor cares about.
+type vmConfig struct {
+	OS         string `json:"os"`
+	MACAddress string `json:"macAddress"`
+}
+
+func readVMConfig(name string) (*vmConfig, error) {
+	b, err := os.ReadFile(vmConfigPath(name))
+	if err != nil {
+		return nil, err
+	}
+	var cfg vmConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// vmMACAddress reads the MAC address Tart assigned to the VM's NIC.
+func vmMACAddress(name string) (string, error) {
+	cfg, err := readVMConfig(name)
+	if err != nil {
+		return "", err
+	}
+	return cfg.MACAddress, nil
+}
+
+// vmOS reports the guest OS of a local VM ("darwin" or "linux").
+func vmOS(name string) (string, error) {
+	cfg, err := readVMConfig(name)
+	if err != nil {
+		return "", err
+	}
+	return cfg.OS, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVMMACAddress(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("TART_HOME", home)
+	dir := filepath.Join(home, "vms", "vm-a")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := `{"version":1,"os":"linux","arch":"arm64","cpuCount":4,"memorySize":4294967296,"macAddress":"7a:65:e4:1b:2c:01"}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mac, err := vmMACAddress("vm-a")
+	if err != nil {
+		t.Fatalf("vmMACAddress failed: %v", err)
+	}
+	if mac != "7a:65:e4:1b:2c:01" {
+		t.Fatalf("unexpected MAC %q", mac)
+	}
+	if _, err := vmMACAddress("missing"); err == nil {
+		t.Fatalf("expected error for unknown VM")
+	}
+}
+
+func TestVMOS(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("TART_HOME", home)
+	dir := filepath.Join(home, "vms", "mac-a")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"version":1,"os":"darwin","arch":"arm64"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	guest, err := vmOS("mac-a")
+	if err != nil {
+		t.Fatalf("vmOS failed: %v", err)
+	}
+	if guest != "darwin" {
+		t.Fatalf("unexpected OS %q", guest)
+	}
+}
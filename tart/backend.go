@@ -0,0 +1,79 @@
+package tart
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// vmBackend is what tart_vm and the tart_vms data source need to manage VMs.
+// The HTTP client talks to the controller; the local backend drives the tart
+// CLI on the machine running Terraform (mode = "local").
+type vmBackend interface {
+	CreateVM(ctx context.Context, in vmCreateRequest) (id, status string, err error)
+	GetVM(ctx context.Context, id string) (*vmResponse, error)
+	// UpdateVM returns the VM's ID afterwards, which a local rename changes.
+	UpdateVM(ctx context.Context, id string, in vmUpdateRequest) (string, error)
+	DeleteVM(ctx context.Context, id string, force bool) error
+	SetVMState(ctx context.Context, id, state string) error
+	GetVMIP(ctx context.Context, id string, wait time.Duration) (*vmIPResponse, error)
+	ListVMs(ctx context.Context) ([]vmResponse, error)
+}
+
+// vms returns the backend selected by the provider's mode.
+func (c *config) vms() vmBackend {
+	if c.Backend != nil {
+		return c.Backend
+	}
+	return httpBackend{conf: c}
+}
+
+// requireAPI rejects resources that only the controller can serve in local mode.
+func (c *config) requireAPI(resource string) diag.Diagnostics {
+	if c.Mode == "local" {
+		return diag.Errorf("%s needs the Tart API controller; it is not available with mode = \"local\"", resource)
+	}
+	return nil
+}
+
+// httpBackend adapts the controller client functions to vmBackend.
+type httpBackend struct {
+	conf *config
+}
+
+func (b httpBackend) CreateVM(ctx context.Context, in vmCreateRequest) (string, string, error) {
+	return createVM(ctx, b.conf, in)
+}
+
+func (b httpBackend) GetVM(ctx context.Context, id string) (*vmResponse, error) {
+	return getVM(ctx, b.conf, id)
+}
+
+func (b httpBackend) UpdateVM(ctx context.Context, id string, in vmUpdateRequest) (string, error) {
+	return id, updateVM(ctx, b.conf, id, in)
+}
+
+func (b httpBackend) DeleteVM(ctx context.Context, id string, force bool) error {
+	return deleteVM(ctx, b.conf, id, force)
+}
+
+func (b httpBackend) SetVMState(ctx context.Context, id, state string) error {
+	return setVMState(ctx, b.conf, id, state)
+}
+
+func (b httpBackend) GetVMIP(ctx context.Context, id string, wait time.Duration) (*vmIPResponse, error) {
+	return getVMIP(ctx, b.conf, id, wait)
+}
+
+func (b httpBackend) ListVMs(ctx context.Context) ([]vmResponse, error) {
+	return listVMs(ctx, b.conf)
+}
+
+// notFoundError reports a missing VM the way the controller's 404 does, so
+// isNotFound treats both backends alike.
+func notFoundError(name string) error {
+	return &apiError{StatusCode: http.StatusNotFound, Status: "404 Not Found", Message: fmt.Sprintf("VM %q not found", name)}
+}
@@ -2,15 +2,46 @@ package tart
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"path"
+	"strconv"
+	"time"
 )
 
 type vmCreateRequest struct {
-	Name  string `json:"name"`
-	Image string `json:"image"`
+	Name              string              `json:"name"`
+	Image             string              `json:"image,omitempty"`
+	SourceVM          string              `json:"source_vm,omitempty"`
+	CPU               int                 `json:"cpu,omitempty"`
+	MemoryMB          int                 `json:"memory_mb,omitempty"`
+	DiskSizeGB        int                 `json:"disk_size_gb,omitempty"`
+	UserData          string              `json:"user_data,omitempty"`
+	MetaData          string              `json:"meta_data,omitempty"`
+	NetworkConfig     string              `json:"network_config,omitempty"`
+	SSHAuthorizedKeys []string            `json:"ssh_authorized_keys,omitempty"`
+	SharedDirectories []sharedDirectory   `json:"shared_directories,omitempty"`
+	Network           *vmNetwork          `json:"network,omitempty"`
+	Disks             []attachedDisk      `json:"disks,omitempty"`
+	AdoptExisting     bool                `json:"adopt_existing,omitempty"`
+	RegistryAuth      *registryCredential `json:"registry_auth,omitempty"`
+}
+
+// vmUpdateRequest carries in-place changes; zero values and nil fields are
+// left untouched.
+type vmUpdateRequest struct {
+	Name              string             `json:"name,omitempty"`
+	CPU               int                `json:"cpu,omitempty"`
+	MemoryMB          int                `json:"memory_mb,omitempty"`
+	DiskSizeGB        int                `json:"disk_size_gb,omitempty"`
+	SharedDirectories *[]sharedDirectory `json:"shared_directories,omitempty"`
+	Network           *vmNetwork         `json:"network,omitempty"`
+	Disks             *[]attachedDisk    `json:"disks,omitempty"`
 }
 
 type vmCreateResponse struct {
@@ -19,10 +50,25 @@ type vmCreateResponse struct {
 }
 
 type vmResponse struct {
-	ID     string `json:"id"`
-	Name   string `json:"name"`
-	Image  string `json:"image"`
-	Status string `json:"status"`
+	ID                string            `json:"id"`
+	Name              string            `json:"name"`
+	Image             string            `json:"image"`
+	ImageDigest       string            `json:"image_digest"`
+	SourceVM          string            `json:"source_vm"`
+	Status            string            `json:"status"`
+	CPU               int               `json:"cpu"`
+	MemoryMB          int               `json:"memory_mb"`
+	DiskSizeGB        int               `json:"disk_size_gb"`
+	IPAddress         string            `json:"ip_address"`
+	MACAddress        string            `json:"mac_address"`
+	SharedDirectories []sharedDirectory `json:"shared_directories"`
+	Network           *vmNetwork        `json:"network"`
+	Disks             []attachedDisk    `json:"disks"`
+}
+
+type vmIPResponse struct {
+	IPAddress  string `json:"ip_address"`
+	MACAddress string `json:"mac_address"`
 }
 
 func apiURLJoin(base string, p string) string {
@@ -30,80 +76,538 @@ func apiURLJoin(base string, p string) string {
 	return fmt.Sprintf("%s%s", base, p)
 }
 
-func createVM(conf *config, name, image string) (string, string, error) {
-	body, _ := json.Marshal(vmCreateRequest{Name: name, Image: image})
-	req, err := http.NewRequest(http.MethodPost, apiURLJoin(conf.ApiURL, "/vms"), bytes.NewReader(body))
+// doRequest sends an API request bound to ctx, so Terraform cancellation and
+// resource timeouts abort it. in, when non-nil, is sent as the JSON body.
+// Idempotent requests (GET, DELETE) are retried on network errors, 5xx and 429
+// up to conf.MaxRetries times. The wait doubles from conf.RetryBackoff, unless
+// the controller (or a proxy in front of it) asks for longer via Retry-After.
+func doRequest(ctx context.Context, conf *config, method, p string, in interface{}, headers ...http.Header) (*http.Response, error) {
+	var payload []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		payload = b
+	}
+	attempts := 1
+	if method == http.MethodGet || method == http.MethodDelete {
+		attempts += conf.MaxRetries
+	}
+	backoff := conf.RetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := sendRequest(ctx, conf, method, p, payload, headers...)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if attempt >= attempts || (err != nil && !isTransient(err)) {
+			return resp, err
+		}
+		wait := backoff
+		if resp != nil {
+			if d, ok := retryAfter(resp, time.Now()); ok && d > wait {
+				wait = d
+			}
+			log.Printf("[DEBUG] %s %s returned %s, retrying in %s", method, p, resp.Status, wait)
+			resp.Body.Close()
+		} else {
+			log.Printf("[DEBUG] %s %s failed: %v, retrying in %s", method, p, err, wait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
+// sendRequest sends one API request; headers, when given, are added to it.
+func sendRequest(ctx context.Context, conf *config, method, p string, payload []byte, headers ...http.Header) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := newAPIRequest(ctx, conf, method, p, body)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, h := range headers {
+		for k, v := range h {
+			req.Header[k] = v
+		}
+	}
+	return conf.httpClient().Do(req)
+}
+
+// newAPIRequest builds a controller request carrying the provider's credentials and workspace.
+func newAPIRequest(ctx context.Context, conf *config, method, p string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, apiURLJoin(conf.ApiURL, p), body)
+	if err != nil {
+		return nil, err
 	}
 	if conf.ApiToken != "" {
 		req.Header.Set("Authorization", "Bearer "+conf.ApiToken)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	if conf.Workspace != "" {
+		req.Header.Set(workspaceHeader, conf.Workspace)
+	}
+	return req, nil
+}
+
+func createVM(ctx context.Context, conf *config, in vmCreateRequest) (string, string, error) {
+	resp, err := doRequest(ctx, conf, http.MethodPost, "/vms", in)
 	if err != nil {
 		return "", "", err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return "", "", fmt.Errorf("unexpected status: %s", resp.Status)
+		return "", "", newAPIError(resp)
 	}
 	var parsed vmCreateResponse
 	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
 		return "", "", err
 	}
 	if parsed.ID == "" {
-		parsed.ID = name
+		parsed.ID = in.Name
 	}
 	if parsed.Status == "" {
-		parsed.Status = "running"
+		// The controller reports new clones as stopped
+		parsed.Status = "stopped"
 	}
 	return parsed.ID, parsed.Status, nil
 }
 
-func getVM(conf *config, id string) (string, string, string, error) {
-	url := apiURLJoin(conf.ApiURL, path.Join("/vms", id))
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+func getVM(ctx context.Context, conf *config, id string) (*vmResponse, error) {
+	resp, err := doRequest(ctx, conf, http.MethodGet, path.Join("/vms", id), nil)
 	if err != nil {
-		return "", "", "", err
+		return nil, err
 	}
-	if conf.ApiToken != "" {
-		req.Header.Set("Authorization", "Bearer "+conf.ApiToken)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed vmResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func updateVM(ctx context.Context, conf *config, id string, in vmUpdateRequest) error {
+	resp, err := doRequest(ctx, conf, http.MethodPatch, path.Join("/vms", id), in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+	return nil
+}
+
+// deleteVM removes a VM. The controller refuses VMs created by another token or
+// workspace unless force is set.
+func deleteVM(ctx context.Context, conf *config, id string, force bool) error {
+	p := path.Join("/vms", id)
+	if force {
+		p += "?force=true"
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := doRequest(ctx, conf, http.MethodDelete, p, nil)
 	if err != nil {
-		return "", "", "", err
+		return err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusNotFound {
-		return "", "", "", fmt.Errorf("not found")
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+	return nil
+}
+
+// vmPowerRoutes maps a desired power state to the API sub-route that reaches it.
+var vmPowerRoutes = map[string]string{
+	"running":   "run",
+	"stopped":   "stop",
+	"suspended": "suspend",
+}
+
+func setVMState(ctx context.Context, conf *config, id, state string) error {
+	route, ok := vmPowerRoutes[state]
+	if !ok {
+		return fmt.Errorf("unsupported state %q", state)
 	}
+	var in interface{}
+	if state == "running" {
+		// Ask the controller not to block until the VM shuts down
+		in = map[string]bool{"detach": true}
+	}
+	resp, err := doRequest(ctx, conf, http.MethodPost, path.Join("/vms", id, route), in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return "", "", "", fmt.Errorf("unexpected status: %s", resp.Status)
+		return newAPIError(resp)
 	}
-	var parsed vmResponse
+	return nil
+}
+
+// getVMIP looks up the VM's addresses; a positive wait lets the executor block
+// (tart ip --wait) until the guest has obtained a lease. A waiting lookup is sent
+// once: the executor answers 502 when the wait expires, and retrying would
+// stretch wait_for_ip_timeout to a multiple of itself.
+func getVMIP(ctx context.Context, conf *config, id string, wait time.Duration) (*vmIPResponse, error) {
+	p := path.Join("/vms", id, "ip")
+	var resp *http.Response
+	var err error
+	if secs := int(wait.Seconds()); secs > 0 {
+		resp, err = sendRequest(ctx, conf, http.MethodGet, p+"?wait="+strconv.Itoa(secs), nil)
+	} else {
+		resp, err = doRequest(ctx, conf, http.MethodGet, p, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed vmIPResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func listVMs(ctx context.Context, conf *config) ([]vmResponse, error) {
+	resp, err := doRequest(ctx, conf, http.MethodGet, "/vms", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed []vmResponse
 	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return "", "", "", err
+		return nil, err
 	}
-	return parsed.Name, parsed.Image, parsed.Status, nil
+	return parsed, nil
 }
 
-func deleteVM(conf *config, id string) error {
-	url := apiURLJoin(conf.ApiURL, path.Join("/vms", id))
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
+func listInterfaces(ctx context.Context, conf *config) ([]hostInterface, error) {
+	resp, err := doRequest(ctx, conf, http.MethodGet, "/interfaces", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed []hostInterface
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+type imageResponse struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Source       string `json:"source"`
+	DiskGB       int    `json:"disk_gb"`
+	SizeGB       int    `json:"size_gb"`
+	LastAccessed string `json:"last_accessed"`
+}
+
+func listImages(ctx context.Context, conf *config) ([]imageResponse, error) {
+	resp, err := doRequest(ctx, conf, http.MethodGet, "/images", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed []imageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+type pulledImageResponse struct {
+	ID           string `json:"id"`
+	Ref          string `json:"ref"`
+	Digest       string `json:"digest"`
+	SizeGB       int    `json:"size_gb"`
+	RemoteDigest string `json:"remote_digest"`
+}
+
+func pullImage(ctx context.Context, conf *config, ref string) (*pulledImageResponse, error) {
+	in := struct {
+		Ref          string              `json:"ref"`
+		RegistryAuth *registryCredential `json:"registry_auth,omitempty"`
+	}{ref, credentialFor(conf.RegistryAuth, ref)}
+	resp, err := doRequest(ctx, conf, http.MethodPost, "/images", in)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed pulledImageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// getImage reads a cached OCI image; with remote set the controller also resolves the registry
+// digest, using auth when the repository is private.
+func getImage(ctx context.Context, conf *config, ref string, remote bool, auth *registryCredential) (*pulledImageResponse, error) {
+	p := "/images/" + ref
+	var headers []http.Header
+	if remote {
+		p += "?remote=true"
+		if auth != nil {
+			headers = append(headers, http.Header{registryAuthHeader: {encodeRegistryAuth(auth)}})
+		}
+	}
+	resp, err := doRequest(ctx, conf, http.MethodGet, p, nil, headers...)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed pulledImageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func deleteImage(ctx context.Context, conf *config, ref string) error {
+	resp, err := doRequest(ctx, conf, http.MethodDelete, "/images/"+ref, nil)
 	if err != nil {
 		return err
 	}
-	if conf.ApiToken != "" {
-		req.Header.Set("Authorization", "Bearer "+conf.ApiToken)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+	return nil
+}
+
+type diskCreateRequest struct {
+	Name   string `json:"name"`
+	SizeGB int    `json:"size_gb"`
+	Label  string `json:"label,omitempty"`
+}
+
+func createDisk(ctx context.Context, conf *config, in diskCreateRequest) (*diskEntry, error) {
+	resp, err := doRequest(ctx, conf, http.MethodPost, "/disks", in)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed diskEntry
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func getDisk(ctx context.Context, conf *config, name string) (*diskEntry, error) {
+	resp, err := doRequest(ctx, conf, http.MethodGet, path.Join("/disks", name), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed diskEntry
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func resizeDisk(ctx context.Context, conf *config, name string, sizeGB int) error {
+	resp, err := doRequest(ctx, conf, http.MethodPatch, path.Join("/disks", name), map[string]int{"size_gb": sizeGB})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+	return nil
+}
+
+func deleteDisk(ctx context.Context, conf *config, name string) error {
+	resp, err := doRequest(ctx, conf, http.MethodDelete, path.Join("/disks", name), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+	return nil
+}
+
+// vmExecRequest runs Command in the guest; Stdin, when set, is piped to it.
+type vmExecRequest struct {
+	Command        []string `json:"command"`
+	Stdin          *string  `json:"stdin,omitempty"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+}
+
+type vmExecResponse struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+}
+
+// execVM runs a command through the Tart guest agent. Not retried: the command
+// may have side effects.
+func execVM(ctx context.Context, conf *config, id string, in vmExecRequest) (*vmExecResponse, error) {
+	resp, err := doRequest(ctx, conf, http.MethodPost, path.Join("/vms", id, "exec"), in)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed vmExecResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// vmFilePath is the API path of a file in the guest; dest travels as a query parameter.
+func vmFilePath(id, dest string, extra url.Values) string {
+	q := url.Values{"path": {dest}}
+	for k, v := range extra {
+		q[k] = v
+	}
+	return path.Join("/vms", id, "files") + "?" + q.Encode()
+}
+
+// uploadVMFile streams body into dest in the guest. Not retried: body may not be rewindable.
+func uploadVMFile(ctx context.Context, conf *config, id, dest, mode string, body io.Reader) (*guestFile, error) {
+	req, err := newAPIRequest(ctx, conf, http.MethodPut, vmFilePath(id, dest, url.Values{"mode": {mode}}), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := conf.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
 	}
-	resp, err := http.DefaultClient.Do(req)
+	var parsed guestFile
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func getVMFile(ctx context.Context, conf *config, id, dest string) (*guestFile, error) {
+	resp, err := doRequest(ctx, conf, http.MethodGet, vmFilePath(id, dest, nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed guestFile
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func deleteVMFile(ctx context.Context, conf *config, id, dest string) error {
+	resp, err := doRequest(ctx, conf, http.MethodDelete, vmFilePath(id, dest, nil), nil)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status: %s", resp.Status)
+		return newAPIError(resp)
 	}
 	return nil
 }
+
+// vmPushRequest publishes a VM under Ref and, in the same repository, every extra tag.
+type vmPushRequest struct {
+	Ref          string              `json:"ref"`
+	Tags         []string            `json:"tags,omitempty"`
+	RegistryAuth *registryCredential `json:"registry_auth,omitempty"`
+}
+
+type pushJobResponse struct {
+	ID     string   `json:"id"`
+	Refs   []string `json:"refs"`
+	Status string   `json:"status"`
+	Digest string   `json:"digest"`
+	Error  string   `json:"error"`
+}
+
+// startPush asks the controller to push a VM; the push runs in the background.
+func startPush(ctx context.Context, conf *config, id string, in vmPushRequest) (*pushJobResponse, error) {
+	resp, err := doRequest(ctx, conf, http.MethodPost, path.Join("/vms", id, "push"), in)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, newAPIError(resp)
+	}
+	var parsed pushJobResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func getPush(ctx context.Context, conf *config, jobID string) (*pushJobResponse, error) {
+	resp, err := doRequest(ctx, conf, http.MethodGet, path.Join("/pushes", jobID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var parsed pushJobResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
@@ -0,0 +1,189 @@
+package tart
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// A cancelled context (e.g. Ctrl-C in Terraform) must abort an in-flight API request.
+func TestCreateVM_ContextCancelAbortsRequest(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, _, err := createVM(ctx, &config{ApiURL: srv.URL}, vmCreateRequest{Name: "slow", Image: "ghcr.io/org/huge:latest"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("request was not aborted promptly")
+	}
+}
+
+func TestGetVM_RetriesTransientErrors(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "executor error", http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"vm1","name":"vm1","image":"img","status":"running"}`))
+	}))
+	defer srv.Close()
+
+	conf := &config{ApiURL: srv.URL, MaxRetries: 2, RetryBackoff: time.Millisecond}
+	vm, err := getVM(context.Background(), conf, "vm1")
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if vm.Name != "vm1" || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("unexpected result %+v after %d calls", vm, calls)
+	}
+}
+
+// A lookup that waits for a lease must not be retried past its wait.
+func TestGetVMIP_WaitIsNotRetried(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "executor error", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	conf := &config{ApiURL: srv.URL, MaxRetries: 3, RetryBackoff: time.Millisecond}
+	if _, err := getVMIP(context.Background(), conf, "vm1", time.Minute); apiStatus(err) != http.StatusBadGateway {
+		t.Fatalf("expected 502 apiError, got %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("expected the waiting lookup to be sent once, got %d", calls)
+	}
+	if _, err := getVMIP(context.Background(), conf, "vm1", 0); apiStatus(err) != http.StatusBadGateway {
+		t.Fatalf("expected 502 apiError, got %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 5 {
+		t.Fatalf("expected a plain lookup to be retried, got %d calls", calls)
+	}
+}
+
+func TestCreateVM_DoesNotRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "executor error", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	conf := &config{ApiURL: srv.URL, MaxRetries: 3, RetryBackoff: time.Millisecond}
+	_, _, err := createVM(context.Background(), conf, vmCreateRequest{Name: "vm1", Image: "img"})
+	if apiStatus(err) != http.StatusBadGateway {
+		t.Fatalf("expected 502 apiError, got %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("expected POST to be sent once, got %d", calls)
+	}
+}
+
+// A controller that omits status has cloned a VM it has not started.
+func TestCreateVM_MissingStatusIsStopped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"vm-1"}`))
+	}))
+	defer srv.Close()
+
+	id, status, err := createVM(context.Background(), &config{ApiURL: srv.URL}, vmCreateRequest{Name: "vm1", Image: "img"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "vm-1" || status != "stopped" {
+		t.Fatalf("expected vm-1 stopped, got %s %s", id, status)
+	}
+}
+
+func TestResourceVMRead_KeepsStateOnTransientError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "executor error", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	d := resourceVM().TestResourceData()
+	d.SetId("vm1")
+	diags := resourceVMRead(context.Background(), d, &config{ApiURL: srv.URL})
+	if !diags.HasError() {
+		t.Fatalf("expected an error diagnostic for a 500 response")
+	}
+	if d.Id() != "vm1" {
+		t.Fatalf("expected VM to stay in state, id is %q", d.Id())
+	}
+}
+
+func TestResourceVMRead_RemovesStateOnNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	d := resourceVM().TestResourceData()
+	d.SetId("vm1")
+	if diags := resourceVMRead(context.Background(), d, &config{ApiURL: srv.URL}); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if d.Id() != "" {
+		t.Fatalf("expected VM to be removed from state on 404")
+	}
+}
+
+// A generated keypair is installed alongside the configured keys and its private half kept in state.
+func TestResourceVMCreate_GeneratesSSHKey(t *testing.T) {
+	var got vmCreateRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			_ = json.NewDecoder(r.Body).Decode(&got)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"web-01","status":"stopped"}`))
+		default:
+			_, _ = w.Write([]byte(`{"id":"web-01","name":"web-01","status":"stopped"}`))
+		}
+	}))
+	defer srv.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceVM().Schema, map[string]interface{}{
+		"name":                "web-01",
+		"image":               "base",
+		"ssh_authorized_keys": []interface{}{"ssh-ed25519 AAAA ops"},
+		"generate_ssh_key":    true,
+	})
+	if diags := resourceVMCreate(context.Background(), d, &config{ApiURL: srv.URL}); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	pub := d.Get("ssh_public_key").(string)
+	if !strings.HasPrefix(pub, "ssh-ed25519 ") || !strings.HasSuffix(pub, " terraform@web-01") {
+		t.Fatalf("unexpected generated public key %q", pub)
+	}
+	if !strings.Contains(d.Get("ssh_private_key").(string), "OPENSSH PRIVATE KEY") {
+		t.Fatalf("expected private key in state")
+	}
+	if len(got.SSHAuthorizedKeys) != 2 || got.SSHAuthorizedKeys[0] != "ssh-ed25519 AAAA ops" || got.SSHAuthorizedKeys[1] != pub {
+		t.Fatalf("unexpected keys sent to controller: %v", got.SSHAuthorizedKeys)
+	}
+}
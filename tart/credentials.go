@@ -0,0 +1,153 @@
+package tart
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrProfileNotFound is returned when the credentials file has no such profile.
+var ErrProfileNotFound = errors.New("profile not found")
+
+// Profile is one controller entry in the shared credentials file.
+type Profile struct {
+	URL      string `yaml:"url"`
+	Token    string `yaml:"token"`
+	CABundle string `yaml:"ca_bundle"`
+}
+
+// CredentialsFilePath returns $TART_CREDENTIALS_FILE or ~/.config/tart/credentials.
+func CredentialsFilePath() string {
+	if p := os.Getenv("TART_CREDENTIALS_FILE"); p != "" {
+		return p
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "tart", "credentials")
+}
+
+// LoadProfile reads the named profile from the credentials file, which may be
+// INI (one [section] per profile) or YAML (a map of profile name to fields).
+func LoadProfile(name string) (*Profile, error) {
+	path := CredentialsFilePath()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := parseCredentials(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	p, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q in %s", ErrProfileNotFound, name, path)
+	}
+	return &p, nil
+}
+
+// ResolveProfile returns the controller settings for profile name (or $TART_PROFILE).
+// A named profile wins over TART_API_URL, TART_API_TOKEN and TART_CA_BUNDLE, which only
+// fill its gaps. Without a name the environment comes first and the optional "default"
+// profile fills the gaps.
+func ResolveProfile(name string) (*Profile, error) {
+	if name == "" {
+		name = os.Getenv("TART_PROFILE")
+	}
+	env := Profile{
+		URL:      os.Getenv("TART_API_URL"),
+		Token:    os.Getenv("TART_API_TOKEN"),
+		CABundle: os.Getenv("TART_CA_BUNDLE"),
+	}
+	if name != "" {
+		p, err := LoadProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		p.fillFrom(env)
+		return p, nil
+	}
+	p := env
+	if def, err := LoadProfile("default"); err == nil {
+		p.fillFrom(*def)
+	} else if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, ErrProfileNotFound) {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Profile) fillFrom(o Profile) {
+	if p.URL == "" {
+		p.URL = o.URL
+	}
+	if p.Token == "" {
+		p.Token = o.Token
+	}
+	if p.CABundle == "" {
+		p.CABundle = o.CABundle
+	}
+}
+
+func parseCredentials(b []byte) (map[string]Profile, error) {
+	if looksLikeINI(b) {
+		return parseINICredentials(b)
+	}
+	profiles := map[string]Profile{}
+	if err := yaml.Unmarshal(b, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// looksLikeINI reports whether the first meaningful line is a [section] header.
+func looksLikeINI(b []byte) bool {
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		return strings.HasPrefix(line, "[")
+	}
+	return false
+}
+
+func parseINICredentials(b []byte) (map[string]Profile, error) {
+	profiles := map[string]Profile{}
+	section := ""
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			profiles[section] = Profile{}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section == "" {
+			return nil, fmt.Errorf("line %d: expected key = value inside a [profile] section", n)
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		p := profiles[section]
+		switch strings.TrimSpace(key) {
+		case "url":
+			p.URL = value
+		case "token":
+			p.Token = value
+		case "ca_bundle":
+			p.CABundle = value
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q", n, strings.TrimSpace(key))
+		}
+		profiles[section] = p
+	}
+	return profiles, sc.Err()
+}
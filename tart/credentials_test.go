@@ -0,0 +1,122 @@
+package tart
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func writeCredentials(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TART_CREDENTIALS_FILE", path)
+	t.Setenv("TART_PROFILE", "")
+	t.Setenv("TART_API_URL", "")
+	t.Setenv("TART_API_TOKEN", "")
+	t.Setenv("TART_CA_BUNDLE", "")
+}
+
+func TestLoadProfile_INI(t *testing.T) {
+	writeCredentials(t, `
+# Mac fleets
+[dev]
+url   = http://dev-mac:8085/api
+token = "dev-token"
+
+[staging]
+url       = https://staging-mac/api
+token     = staging-token
+ca_bundle = /etc/tart/staging-ca.pem
+`)
+	p, err := LoadProfile("staging")
+	if err != nil {
+		t.Fatalf("LoadProfile failed: %v", err)
+	}
+	want := Profile{URL: "https://staging-mac/api", Token: "staging-token", CABundle: "/etc/tart/staging-ca.pem"}
+	if *p != want {
+		t.Fatalf("got %+v, want %+v", *p, want)
+	}
+	if _, err := LoadProfile("prod"); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("expected ErrProfileNotFound, got %v", err)
+	}
+}
+
+func TestLoadProfile_YAML(t *testing.T) {
+	writeCredentials(t, `
+dev:
+  url: http://dev-mac:8085/api
+  token: dev-token
+`)
+	p, err := LoadProfile("dev")
+	if err != nil {
+		t.Fatalf("LoadProfile failed: %v", err)
+	}
+	if p.URL != "http://dev-mac:8085/api" || p.Token != "dev-token" {
+		t.Fatalf("unexpected profile %+v", *p)
+	}
+}
+
+func TestResolveProfile_Precedence(t *testing.T) {
+	writeCredentials(t, `
+[default]
+url   = http://default:8085/api
+token = default-token
+
+[dev]
+url = http://dev:8085/api
+`)
+	t.Setenv("TART_API_URL", "http://env:8085/api")
+	t.Setenv("TART_API_TOKEN", "env-token")
+
+	// A named profile wins; the environment only fills its gaps
+	p, err := ResolveProfile("dev")
+	if err != nil {
+		t.Fatalf("ResolveProfile failed: %v", err)
+	}
+	if p.URL != "http://dev:8085/api" || p.Token != "env-token" {
+		t.Fatalf("unexpected named profile resolution %+v", *p)
+	}
+
+	// Without a name the environment wins over the default profile
+	p, err = ResolveProfile("")
+	if err != nil {
+		t.Fatalf("ResolveProfile failed: %v", err)
+	}
+	if p.URL != "http://env:8085/api" || p.Token != "env-token" {
+		t.Fatalf("unexpected unnamed resolution %+v", *p)
+	}
+
+	// TART_PROFILE selects a profile like the provider argument does
+	t.Setenv("TART_PROFILE", "dev")
+	if p, err = ResolveProfile(""); err != nil || p.URL != "http://dev:8085/api" {
+		t.Fatalf("expected TART_PROFILE to select dev, got %+v, %v", p, err)
+	}
+}
+
+func TestConfigureProvider_FromProfile(t *testing.T) {
+	writeCredentials(t, `
+[dev]
+url   = http://dev:8085/api
+token = dev-token
+`)
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{"profile": "dev"})
+	meta, err := configureProvider(d)
+	if err != nil {
+		t.Fatalf("configureProvider failed: %v", err)
+	}
+	conf := meta.(*config)
+	if conf.ApiURL != "http://dev:8085/api" || conf.ApiToken != "dev-token" {
+		t.Fatalf("unexpected config %+v", conf)
+	}
+
+	d = schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{"profile": "missing"})
+	if _, err := configureProvider(d); err == nil {
+		t.Fatalf("expected error for unknown profile")
+	}
+}
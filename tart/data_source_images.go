@@ -0,0 +1,122 @@
+package tart
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceImages() *schema.Resource {
+	return &schema.Resource{
+		Description: "Lists local Tart images and cached OCI images on the executor host, newest first",
+		ReadContext: dataSourceImagesRead,
+		Schema: map[string]*schema.Schema{
+			"source": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice([]string{"local", "oci"}, false),
+				Description:  "Only return images from this source: local or oci",
+			},
+			"name_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringIsValidRegExp,
+				Description:  "Only return images whose name matches this regular expression",
+			},
+			"min_size_gb": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Only return images using at least this many GB on disk",
+			},
+			"max_size_gb": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Only return images using at most this many GB on disk",
+			},
+			"images": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name":          {Type: schema.TypeString, Computed: true},
+						"source":        {Type: schema.TypeString, Computed: true},
+						"disk_gb":       {Type: schema.TypeInt, Computed: true},
+						"size_gb":       {Type: schema.TypeInt, Computed: true},
+						"last_accessed": {Type: schema.TypeString, Computed: true},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceImagesRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_images"); diags != nil {
+		return diags
+	}
+	images, err := listImages(ctx, conf)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	var nameRe *regexp.Regexp
+	if v, ok := d.GetOk("name_regex"); ok {
+		nameRe = regexp.MustCompile(v.(string))
+	}
+	source := d.Get("source").(string)
+	minSize := d.Get("min_size_gb").(int)
+	maxSize := d.Get("max_size_gb").(int)
+
+	// Newest first, then by name for stability; images without a timestamp sort last
+	accessed := make(map[string]time.Time, len(images))
+	for _, img := range images {
+		if ts, err := time.Parse(time.RFC3339, img.LastAccessed); err == nil {
+			accessed[img.Name] = ts
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		ti, tj := accessed[images[i].Name], accessed[images[j].Name]
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return images[i].Name < images[j].Name
+	})
+
+	out := make([]map[string]interface{}, 0, len(images))
+	names := make([]string, 0, len(images))
+	for _, img := range images {
+		if source != "" && img.Source != source {
+			continue
+		}
+		if nameRe != nil && !nameRe.MatchString(img.Name) {
+			continue
+		}
+		if minSize > 0 && img.SizeGB < minSize {
+			continue
+		}
+		if maxSize > 0 && img.SizeGB > maxSize {
+			continue
+		}
+		out = append(out, map[string]interface{}{
+			"name":          img.Name,
+			"source":        img.Source,
+			"disk_gb":       img.DiskGB,
+			"size_gb":       img.SizeGB,
+			"last_accessed": img.LastAccessed,
+		})
+		names = append(names, img.Name)
+	}
+	if err := d.Set("images", out); err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(names, ",")))))
+	return nil
+}
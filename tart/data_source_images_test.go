@@ -0,0 +1,44 @@
+package tart
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestDataSourceImagesRead_NewestLocalFirst(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+  {"id":"undated-base","name":"undated-base","source":"local","disk_gb":50,"size_gb":20},
+  {"id":"old-base","name":"old-base","source":"local","disk_gb":50,"size_gb":20,"last_accessed":"2026-03-01T00:00:00+09:00"},
+  {"id":"new-base","name":"new-base","source":"local","disk_gb":50,"size_gb":25,"last_accessed":"2026-02-28T20:00:00Z"},
+  {"id":"ghcr.io/cirruslabs/ubuntu:latest","name":"ghcr.io/cirruslabs/ubuntu:latest","source":"oci","disk_gb":20,"size_gb":4}
+]`))
+	}))
+	defer api.Close()
+
+	d := schema.TestResourceDataRaw(t, dataSourceImages().Schema, map[string]interface{}{
+		"source":      "local",
+		"name_regex":  "-base$",
+		"min_size_gb": 10,
+	})
+	if diags := dataSourceImagesRead(context.Background(), d, &config{ApiURL: api.URL}); diags.HasError() {
+		t.Fatalf("read failed: %v", diags)
+	}
+	images := d.Get("images").([]interface{})
+	if len(images) != 3 {
+		t.Fatalf("expected 3 local images, got %d", len(images))
+	}
+	var order []string
+	for _, img := range images {
+		order = append(order, img.(map[string]interface{})["name"].(string))
+	}
+	if strings.Join(order, ",") != "new-base,old-base,undated-base" {
+		t.Fatalf("expected newest image first and undated last, got %v", order)
+	}
+}
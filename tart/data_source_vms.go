@@ -0,0 +1,96 @@
+package tart
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceVMs() *schema.Resource {
+	return &schema.Resource{
+		Description: "Lists VMs known to the Tart API controller",
+		ReadContext: dataSourceVMsRead,
+		Schema: map[string]*schema.Schema{
+			"name_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringIsValidRegExp,
+				Description:  "Only return VMs whose name matches this regular expression",
+			},
+			"image": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Only return VMs created from this image",
+			},
+			"status": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Only return VMs in this status (e.g. running, stopped)",
+			},
+			"vms": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id":         {Type: schema.TypeString, Computed: true},
+						"name":       {Type: schema.TypeString, Computed: true},
+						"image":      {Type: schema.TypeString, Computed: true},
+						"status":     {Type: schema.TypeString, Computed: true},
+						"ip_address": {Type: schema.TypeString, Computed: true},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceVMsRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	vms, err := conf.vms().ListVMs(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	var nameRe *regexp.Regexp
+	if v, ok := d.GetOk("name_regex"); ok {
+		nameRe = regexp.MustCompile(v.(string))
+	}
+	image := d.Get("image").(string)
+	status := d.Get("status").(string)
+
+	// The controller lists from a map; sort for a stable plan
+	sort.Slice(vms, func(i, j int) bool { return vms[i].Name < vms[j].Name })
+
+	out := make([]map[string]interface{}, 0, len(vms))
+	ids := make([]string, 0, len(vms))
+	for _, vm := range vms {
+		if nameRe != nil && !nameRe.MatchString(vm.Name) {
+			continue
+		}
+		if image != "" && vm.Image != image {
+			continue
+		}
+		if status != "" && vm.Status != status {
+			continue
+		}
+		out = append(out, map[string]interface{}{
+			"id":         vm.ID,
+			"name":       vm.Name,
+			"image":      vm.Image,
+			"status":     vm.Status,
+			"ip_address": vm.IPAddress,
+		})
+		ids = append(ids, vm.ID)
+	}
+	if err := d.Set("vms", out); err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(ids, ",")))))
+	return nil
+}
@@ -0,0 +1,49 @@
+package tart
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestDataSourceVMsRead_Filters(t *testing.T) {
+	_ = startFakeExecutor(t)
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+
+	for _, vm := range []map[string]string{
+		{"name": "ds-web-1", "image": "debian-13-arm64"},
+		{"name": "ds-web-2", "image": "ubuntu-24"},
+		{"name": "ds-db-1", "image": "debian-13-arm64"},
+	} {
+		body, _ := json.Marshal(vm)
+		resp, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("create request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	d := schema.TestResourceDataRaw(t, dataSourceVMs().Schema, map[string]interface{}{
+		"name_regex": "^ds-web-",
+		"image":      "debian-13-arm64",
+	})
+	if diags := dataSourceVMsRead(context.Background(), d, &config{ApiURL: srv.URL + "/api"}); diags.HasError() {
+		t.Fatalf("read failed: %v", diags)
+	}
+	vms := d.Get("vms").([]interface{})
+	if len(vms) != 1 {
+		t.Fatalf("expected 1 matching VM, got %d: %v", len(vms), vms)
+	}
+	if name := vms[0].(map[string]interface{})["name"]; name != "ds-web-1" {
+		t.Fatalf("expected ds-web-1, got %v", name)
+	}
+	if d.Id() == "" {
+		t.Fatalf("expected data source ID to be set")
+	}
+}
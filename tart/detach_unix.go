@@ -0,0 +1,14 @@
+//go:build !windows
+
+package tart
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess puts cmd in a process group of its own, so signals sent to the
+// provider's group do not reach it.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package tart
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestDetachProcess_OwnProcessGroup(t *testing.T) {
+	cmd := exec.Command("sleep", "5")
+	detachProcess(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pgid == syscall.Getpgrp() || pgid != cmd.Process.Pid {
+		t.Fatalf("expected tart run to lead its own process group, got pgid %d (ours %d)", pgid, syscall.Getpgrp())
+	}
+}
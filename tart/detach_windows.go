@@ -0,0 +1,8 @@
+//go:build windows
+
+package tart
+
+import "os/exec"
+
+// detachProcess is a no-op on Windows, where Tart does not run.
+func detachProcess(cmd *exec.Cmd) {}
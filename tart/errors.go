@@ -0,0 +1,98 @@
+package tart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// apiError is returned when the controller answers with an unexpected status code.
+type apiError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("unexpected status: %s: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("unexpected status: %s", e.Status)
+}
+
+// newAPIError builds an apiError from resp, keeping the first line of the body
+// (the controller replies with http.Error plain text).
+func newAPIError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	msg := strings.TrimSpace(string(b))
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+	return &apiError{StatusCode: resp.StatusCode, Status: resp.Status, Message: msg}
+}
+
+func apiStatus(err error) int {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae.StatusCode
+	}
+	return 0
+}
+
+// isNotFound reports whether the controller said the object does not exist.
+// Only this case may remove a resource from state.
+func isNotFound(err error) bool {
+	return apiStatus(err) == http.StatusNotFound
+}
+
+// isAuthError reports whether the controller rejected our credentials.
+func isAuthError(err error) bool {
+	code := apiStatus(err)
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// isTransient reports whether retrying the request later may succeed:
+// network timeouts, refused or reset connections, 5xx and 429 responses, but
+// not cancellation by Terraform. Anything else, such as a TLS certificate
+// error, fails the same way on every attempt.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return retryableStatus(ae.StatusCode)
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// apiErrorDiag turns a client error into a diagnostic whose summary says what kind of failure it was.
+func apiErrorDiag(err error, action string) diag.Diagnostics {
+	switch {
+	case isAuthError(err):
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Tart API rejected the credentials while " + action,
+			Detail:   err.Error() + "\n\nCheck the provider's api_token.",
+		}}
+	case isTransient(err):
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Tart API unavailable while " + action,
+			Detail:   err.Error() + "\n\nThe resource was kept in state. Retry once the controller is reachable, or raise the provider's max_retries.",
+		}}
+	default:
+		return diag.Errorf("%s: %v", action, err)
+	}
+}
@@ -0,0 +1,60 @@
+package tart
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorClassification(t *testing.T) {
+	notFound := &apiError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	unauthorized := &apiError{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized"}
+	badGateway := &apiError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"}
+	badRequest := &apiError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request"}
+	connRefused := &url.Error{Op: "Get", URL: "http://127.0.0.1:8085/api/vms", Err: &net.OpError{
+		Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+	}}
+	connReset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	timeout := &url.Error{Op: "Get", URL: "https://tart.example/api/vms", Err: timeoutError{}}
+	badCert := &url.Error{Op: "Get", URL: "https://tart.example/api/vms", Err: x509.UnknownAuthorityError{}}
+
+	cases := []struct {
+		name                      string
+		err                       error
+		notFound, auth, transient bool
+	}{
+		{"404", notFound, true, false, false},
+		{"wrapped 404", fmt.Errorf("read vm: %w", notFound), true, false, false},
+		{"401", unauthorized, false, true, false},
+		{"502", badGateway, false, false, true},
+		{"400", badRequest, false, false, false},
+		{"connection refused", connRefused, false, false, true},
+		{"connection reset", connReset, false, false, true},
+		{"timeout", timeout, false, false, true},
+		{"untrusted certificate", badCert, false, false, false},
+		{"cancelled", context.Canceled, false, false, false},
+	}
+	for _, tc := range cases {
+		if got := isNotFound(tc.err); got != tc.notFound {
+			t.Errorf("%s: isNotFound=%v, want %v", tc.name, got, tc.notFound)
+		}
+		if got := isAuthError(tc.err); got != tc.auth {
+			t.Errorf("%s: isAuthError=%v, want %v", tc.name, got, tc.auth)
+		}
+		if got := isTransient(tc.err); got != tc.transient {
+			t.Errorf("%s: isTransient=%v, want %v", tc.name, got, tc.transient)
+		}
+	}
+}
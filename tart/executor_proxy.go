@@ -2,11 +2,15 @@ package tart
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 )
 
 type execPayload struct {
@@ -21,18 +25,20 @@ type execResponse struct {
 
 // forwardToExecutor sends an action/payload to the Tart executor daemon.
 // Target URL can be configured via EXECUTOR_URL env var (default: http://localhost:9090).
-func forwardToExecutor(action string, payload interface{}) error {
+// Handlers pass the request's context, so a client that gives up also aborts the executor call.
+func forwardToExecutor(ctx context.Context, action string, payload interface{}) error {
+	return forwardToExecutorResult(ctx, action, payload, nil)
+}
+
+// forwardToExecutorResult behaves like forwardToExecutor and additionally decodes the
+// executor's JSON response into out (when non-nil) so callers can read action results.
+func forwardToExecutorResult(ctx context.Context, action string, payload interface{}, out interface{}) error {
 	cmd := execPayload{Action: action, Data: payload}
 	b, err := json.Marshal(cmd)
 	if err != nil {
 		return err
 	}
-	base := os.Getenv("EXECUTOR_URL")
-	if base == "" {
-		base = "http://localhost:9090"
-	}
-	url := base + "/execute"
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, executorURL()+"/execute", bytes.NewReader(b))
 	if err != nil {
 		return err
 	}
@@ -43,15 +49,64 @@ func forwardToExecutor(action string, payload interface{}) error {
 		return err
 	}
 	defer resp.Body.Close()
+	return decodeExecutorResponse(resp, out)
+}
+
+// executorURL is the base URL of the executor daemon.
+func executorURL() string {
+	if base := os.Getenv("EXECUTOR_URL"); base != "" {
+		return base
+	}
+	return "http://localhost:9090"
+}
+
+// streamToExecutor PUTs body to the executor's /upload endpoint (the write_file
+// action) without buffering it, and decodes the JSON response into out.
+func streamToExecutor(ctx context.Context, query url.Values, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, executorURL()+"/upload?"+query.Encode(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("streamToExecutor request failed: %v", err)
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeExecutorResponse(resp, out)
+}
+
+// executorStatusError is returned when the executor answers with a non-200
+// status; Message is its http.Error text.
+type executorStatusError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *executorStatusError) Error() string {
+	return fmt.Sprintf("executor unexpected status: %s", e.Status)
+}
+
+func decodeExecutorResponse(resp *http.Response, out interface{}) error {
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("executor unexpected status: %s", resp.Status)
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &executorStatusError{StatusCode: resp.StatusCode, Status: resp.Status, Message: strings.TrimSpace(string(b))}
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
 	}
 	var er execResponse
-	if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
+	if err := json.Unmarshal(raw, &er); err != nil {
 		return err
 	}
 	if er.Error != "" {
 		return fmt.Errorf("executor error: %s", er.Error)
 	}
+	if out != nil {
+		return json.Unmarshal(raw, out)
+	}
 	return nil
 }
@@ -1,10 +1,13 @@
 package tart
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestForwardToExecutor_Success(t *testing.T) {
@@ -22,7 +25,7 @@ func TestForwardToExecutor_Success(t *testing.T) {
 		if old == "" { os.Unsetenv("EXECUTOR_URL") } else { os.Setenv("EXECUTOR_URL", old) }
 	}()
 
-	if err := forwardToExecutor("clone_vm", map[string]string{"name":"n","image":"i"}); err != nil {
+	if err := forwardToExecutor(context.Background(), "clone_vm", map[string]string{"name":"n","image":"i"}); err != nil {
 		t.Fatalf("expected success, got error: %v", err)
 	}
 }
@@ -41,7 +44,29 @@ func TestForwardToExecutor_Non200(t *testing.T) {
 		if old == "" { os.Unsetenv("EXECUTOR_URL") } else { os.Setenv("EXECUTOR_URL", old) }
 	}()
 
-	if err := forwardToExecutor("pull_image", map[string]string{"ref":"x"}); err == nil {
+	if err := forwardToExecutor(context.Background(), "pull_image", map[string]string{"ref":"x"}); err == nil {
 		t.Fatalf("expected error on non-200 status")
 	}
 }
+
+func TestForwardToExecutor_ContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	serveExecutor(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := forwardToExecutor(ctx, "pull_image", map[string]string{"ref": "x"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to abort the call, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the call to return when the context ends, took %v", elapsed)
+	}
+}
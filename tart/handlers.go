@@ -1,18 +1,78 @@
 package tart
 
 import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
     "encoding/json"
+    "errors"
+    "fmt"
     "log"
     "net/http"
+    "sort"
+    "strconv"
     "strings"
     "sync"
 )
 
 type vmEntry struct {
-    ID     string `json:"id"`
-    Name   string `json:"name"`
-    Image  string `json:"image"`
-    Status string `json:"status"`
+    ID          string `json:"id"`
+    Name        string `json:"name"`
+    Image       string `json:"image"`
+    // ImageDigest is the manifest digest that Image resolved to when it was pulled
+    ImageDigest string `json:"image_digest,omitempty"`
+    Status      string `json:"status"`
+    CPU         int    `json:"cpu,omitempty"`
+    MemoryMB    int    `json:"memory_mb,omitempty"`
+    DiskSizeGB  int    `json:"disk_size_gb,omitempty"`
+    IPAddress   string `json:"ip_address,omitempty"`
+    MACAddress  string `json:"mac_address,omitempty"`
+
+    // SourceVM is the ID of the managed VM this one was cloned from; Clones lists
+    // the VMs cloned from this one and is filled in when the entry is served
+    SourceVM string   `json:"source_vm,omitempty"`
+    Clones   []string `json:"clones,omitempty"`
+
+    // SharedDirectories, Network and Disks become `tart run` flags on every start
+    SharedDirectories []sharedDirectory `json:"shared_directories,omitempty"`
+    Network           *vmNetwork        `json:"network,omitempty"`
+    Disks             []attachedDisk    `json:"disks,omitempty"`
+
+    // Owner is set on VMs created through the API, not on adopted ones; deletes are refused
+    // for anyone else. It only lives in vmStore, so it is lost when the controller restarts
+    Owner *vmOwner `json:"owner,omitempty"`
+}
+
+// vmHardware is the subset of VM settings applied through `tart set`.
+// Zero values mean "leave unchanged".
+type vmHardware struct {
+    CPU        int `json:"cpu,omitempty"`
+    MemoryMB   int `json:"memory_mb,omitempty"`
+    DiskSizeGB int `json:"disk_size_gb,omitempty"`
+}
+
+func (h vmHardware) isZero() bool {
+    return h.CPU == 0 && h.MemoryMB == 0 && h.DiskSizeGB == 0
+}
+
+// setVMHardware forwards a set_vm action for the named VM.
+func setVMHardware(ctx context.Context, name string, h vmHardware) error {
+    return forwardToExecutor(ctx, "set_vm", map[string]interface{}{
+        "name":         name,
+        "cpu":          h.CPU,
+        "memory_mb":    h.MemoryMB,
+        "disk_size_gb": h.DiskSizeGB,
+    })
+}
+
+// writeSharedDirError answers 403 for host paths outside the allowlist and 400 for other invalid shares.
+func writeSharedDirError(w http.ResponseWriter, err error) {
+    var denied sharedDirNotAllowedError
+    if errors.As(err, &denied) {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    http.Error(w, err.Error(), http.StatusBadRequest)
 }
 
 // isRegistryRef heuristically determines whether an image string refers to a remote
@@ -36,21 +96,63 @@ var (
     vmStore = map[string]vmEntry{}
 )
 
+// newVMID generates the stable controller ID of a VM; unlike the name it survives renames.
+func newVMID() string {
+    b := make([]byte, 8)
+    if _, err := rand.Read(b); err != nil {
+        panic(err)
+    }
+    return "vm-" + hex.EncodeToString(b)
+}
+
+// resolveVMID maps a path segment to a store ID. A VM name is accepted as well,
+// so `terraform import` by name and states written when IDs were names keep working.
+func resolveVMID(key string) string {
+    vmMu.RLock()
+    defer vmMu.RUnlock()
+    if _, ok := vmStore[key]; ok {
+        return key
+    }
+    for id, ent := range vmStore {
+        if ent.Name == key {
+            return id
+        }
+    }
+    return key
+}
+
 func SetupRouter() http.Handler {
     mux := http.NewServeMux()
     mux.HandleFunc("/api/vms", AuthMiddleware(handleVMs))
     mux.HandleFunc("/api/vms/", AuthMiddleware(handleVMByID))
     mux.HandleFunc("/api/images", AuthMiddleware(handleImages))
+    mux.HandleFunc("/api/images/", AuthMiddleware(handleImageByRef))
+    mux.HandleFunc("/api/interfaces", AuthMiddleware(handleInterfaces))
+    mux.HandleFunc("/api/disks", AuthMiddleware(handleDisks))
+    mux.HandleFunc("/api/disks/", AuthMiddleware(handleDiskByName))
+    mux.HandleFunc("/api/pushes/", AuthMiddleware(handlePushByID))
     return mux
 }
 
 func handleVMs(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
     switch r.Method {
     case "POST":
         // Validate input
         var payload struct {
-            Name  string `json:"name"`
-            Image string `json:"image"`
+            Name              string              `json:"name"`
+            Image             string              `json:"image"`
+            SourceVM          string              `json:"source_vm"`
+            AdoptExisting     bool                `json:"adopt_existing"`
+            UserData          string              `json:"user_data"`
+            MetaData          string              `json:"meta_data"`
+            NetworkConfig     string              `json:"network_config"`
+            SSHAuthorizedKeys []string            `json:"ssh_authorized_keys"`
+            SharedDirectories []sharedDirectory   `json:"shared_directories"`
+            Network           *vmNetwork          `json:"network"`
+            Disks             []attachedDisk      `json:"disks"`
+            RegistryAuth      *registryCredential `json:"registry_auth"`
+            vmHardware
         }
         if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
             http.Error(w, "invalid json payload", http.StatusBadRequest)
@@ -60,18 +162,84 @@ func handleVMs(w http.ResponseWriter, r *http.Request) {
             http.Error(w, "missing name", http.StatusBadRequest)
             return
         }
-        // Path 1: URL image -> download + create-from-image
-        if strings.HasPrefix(payload.Image, "http://") || strings.HasPrefix(payload.Image, "https://") {
+        if err := validateSharedDirs(payload.SharedDirectories, sharedDirAllowlist()); err != nil {
+            writeSharedDirError(w, err)
+            return
+        }
+        if err := validateNetwork(payload.Network); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        if err := validateAttachedDisks(payload.Disks); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        pullData, err := pullImageData(payload.Image, payload.RegistryAuth)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        // tart clone fails on an existing name, so look first and either adopt the VM or explain the conflict
+        host, err := lookupHostVM(ctx, payload.Name)
+        if err != nil {
+            log.Printf("executor get_vm_state failed for %s: %v", payload.Name, err)
+        }
+        present, observed := host.Present, host.State
+        if present {
+            if id := resolveVMID(payload.Name); id != payload.Name {
+                http.Error(w, fmt.Sprintf("VM %q already exists and is managed as %s", payload.Name, id), http.StatusConflict)
+                return
+            }
+            if !payload.AdoptExisting {
+                http.Error(w, fmt.Sprintf("VM %q already exists on the host (%s) but is not managed by this controller; set adopt_existing to take it over", payload.Name, observed), http.StatusConflict)
+                return
+            }
+        }
+        adopt := present && payload.AdoptExisting
+        if adopt && (payload.UserData != "" || payload.MetaData != "" || payload.NetworkConfig != "" || len(payload.SSHAuthorizedKeys) > 0) {
+            // An adopted VM has booted before, so cloud-init would never read a new seed
+            http.Error(w, fmt.Sprintf("VM %q already exists; user_data, meta_data, network_config and SSH keys only apply to new VMs and cannot be used to adopt it", payload.Name), http.StatusBadRequest)
+            return
+        }
+        if payload.Image != "" && payload.SourceVM != "" {
+            http.Error(w, "image and source_vm are mutually exclusive", http.StatusBadRequest)
+            return
+        }
+        if !adopt && payload.Image == "" && payload.SourceVM == "" {
+            http.Error(w, "exactly one of image or source_vm is required", http.StatusBadRequest)
+            return
+        }
+        var source vmEntry
+        var imageDigest string
+        if payload.SourceVM != "" && !adopt {
+            var code int
+            if source, code, err = cloneSource(ctx, payload.SourceVM); err != nil {
+                http.Error(w, err.Error(), code)
+                return
+            }
+        }
+        if adopt {
+            // Adopting: take over the VM as it is; its disk is left untouched
+            log.Printf("adopting existing VM %s", payload.Name)
+        } else if source.ID != "" {
+            // Path 0: copy-on-write clone of a managed VM
+            if err := forwardToExecutor(ctx, "clone_vm", map[string]string{"name": payload.Name, "image": source.Name}); err != nil {
+                log.Printf("executor clone_vm failed: %v", err)
+                http.Error(w, "executor error", http.StatusBadGateway)
+                return
+            }
+        } else if strings.HasPrefix(payload.Image, "http://") || strings.HasPrefix(payload.Image, "https://") {
+            // Path 1: URL image -> download + create-from-image
             dl := map[string]string{
                 "url":      payload.Image,
                 "destName": payload.Name,
             }
-            if err := forwardToExecutor("download_image", dl); err != nil {
+            if err := forwardToExecutor(ctx, "download_image", dl); err != nil {
                 log.Printf("executor download_image failed: %v", err)
                 http.Error(w, "executor error", http.StatusBadGateway)
                 return
             }
-            if err := forwardToExecutor("create_vm", payload); err != nil {
+            if err := forwardToExecutor(ctx, "create_vm", payload); err != nil {
                 log.Printf("executor create_vm failed: %v", err)
                 http.Error(w, "executor error", http.StatusBadGateway)
                 return
@@ -80,26 +248,102 @@ func handleVMs(w http.ResponseWriter, r *http.Request) {
             // Path 2: If image looks like a remote registry ref, pull then clone.
             // Otherwise treat as a local image name and just clone.
             if isRegistryRef(payload.Image) {
-                if err := forwardToExecutor("pull_image", map[string]string{"ref": payload.Image}); err != nil {
+                if err := forwardToExecutor(ctx, "pull_image", pullData); err != nil {
                     log.Printf("executor pull_image failed: %v", err)
                     http.Error(w, "executor error", http.StatusBadGateway)
                     return
                 }
+                // Record what the tag pointed at, so later tag moves can be detected
+                if img, ok, err := inspectImage(ctx, payload.Image); err != nil {
+                    log.Printf("executor image_info failed for %s: %v", payload.Image, err)
+                } else if ok {
+                    imageDigest = img.Digest
+                }
             }
-            if err := forwardToExecutor("clone_vm", map[string]string{"name": payload.Name, "image": payload.Image}); err != nil {
+            if err := forwardToExecutor(ctx, "clone_vm", map[string]string{"name": payload.Name, "image": payload.Image}); err != nil {
                 log.Printf("executor clone_vm failed: %v", err)
                 http.Error(w, "executor error", http.StatusBadGateway)
                 return
             }
         }
+        // Build the cloud-init seed; the executor attaches it on the VM's first run.
+        // SSH keys travel with it and the executor picks cloud-init or the guest agent per guest OS.
+        if !adopt && (payload.UserData != "" || payload.MetaData != "" || payload.NetworkConfig != "" || len(payload.SSHAuthorizedKeys) > 0) {
+            seed := map[string]interface{}{
+                "name":                payload.Name,
+                "user_data":           payload.UserData,
+                "meta_data":           payload.MetaData,
+                "network_config":      payload.NetworkConfig,
+                "ssh_authorized_keys": payload.SSHAuthorizedKeys,
+            }
+            if err := forwardToExecutor(ctx, "create_seed", seed); err != nil {
+                log.Printf("executor create_seed failed: %v", err)
+                http.Error(w, "executor error", http.StatusBadGateway)
+                return
+            }
+        }
+        // Apply requested hardware settings on the fresh clone
+        if !payload.vmHardware.isZero() {
+            if err := setVMHardware(ctx, payload.Name, payload.vmHardware); err != nil {
+                log.Printf("executor set_vm failed: %v", err)
+                http.Error(w, "executor error", http.StatusBadGateway)
+                return
+            }
+        }
+        status := "stopped"
+        diskSizeGB := payload.DiskSizeGB
+        if adopt && observed != "" {
+            status = observed
+        }
+        if adopt && diskSizeGB == 0 {
+            diskSizeGB = host.DiskGB
+        }
+        if !adopt && diskSizeGB == 0 {
+            // Record the size the clone inherited, so a later smaller disk_size_gb plans a replacement
+            if cloned, err := lookupHostVM(ctx, payload.Name); err != nil {
+                log.Printf("executor get_vm_state failed for %s: %v", payload.Name, err)
+            } else {
+                diskSizeGB = cloned.DiskGB
+            }
+        }
+        // An adopted VM was made by someone else, so it gets no owner and deleting it needs force
+        var owner *vmOwner
+        if !adopt {
+            o := requestOwner(r)
+            owner = &o
+        }
         // Persist in store on success
-        ent := vmEntry{ID: payload.Name, Name: payload.Name, Image: payload.Image, Status: "running"}
+        ent := vmEntry{
+            ID:                newVMID(),
+            Name:              payload.Name,
+            Image:             payload.Image,
+            ImageDigest:       imageDigest,
+            SourceVM:          source.ID,
+            Status:            status,
+            CPU:               payload.CPU,
+            MemoryMB:          payload.MemoryMB,
+            DiskSizeGB:        diskSizeGB,
+            SharedDirectories: payload.SharedDirectories,
+            Network:           payload.Network,
+            Disks:             payload.Disks,
+            Owner:             owner,
+        }
         vmMu.Lock()
+        // The clone succeeded, so any entry still holding this name describes a VM deleted out of band
+        for id, old := range vmStore {
+            if old.Name == ent.Name {
+                delete(vmStore, id)
+            }
+        }
         vmStore[ent.ID] = ent
         vmMu.Unlock()
         w.WriteHeader(http.StatusCreated)
         json.NewEncoder(w).Encode(map[string]string{"id": ent.ID, "status": ent.Status})
     case "GET":
+        if r.URL.Query().Get("unmanaged") == "true" {
+            listUnmanagedVMs(ctx, w)
+            return
+        }
         // List VMs
         vmMu.RLock()
         list := make([]vmEntry, 0, len(vmStore))
@@ -113,29 +357,43 @@ func handleVMs(w http.ResponseWriter, r *http.Request) {
     }
 }
 
+// vmPowerActions maps power sub-routes to executor actions and the status they leave the VM in.
+var vmPowerActions = map[string]struct {
+    action string
+    status string
+}{
+    "run":     {action: "run_vm", status: "running"},
+    "stop":    {action: "stop_vm", status: "stopped"},
+    "suspend": {action: "suspend_vm", status: "suspended"},
+}
+
 func handleVMByID(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
     path := strings.TrimPrefix(r.URL.Path, "/api/vms/")
-    // Handle sub-resource /run
-    if strings.HasSuffix(path, "/run") {
-        id := strings.TrimSuffix(path, "/run")
-        if r.Method != http.MethodPost {
-            http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    // Handle power sub-resources /run, /stop, /suspend, the /ip lookup, /exec, /files and /push
+    if i := strings.LastIndex(path, "/"); i >= 0 {
+        if op, ok := vmPowerActions[path[i+1:]]; ok {
+            handleVMPower(w, r, resolveVMID(path[:i]), op.action, op.status)
             return
         }
-        if id == "" {
-            http.Error(w, "missing id", http.StatusBadRequest)
+        if path[i+1:] == "ip" {
+            handleVMIP(w, r, resolveVMID(path[:i]))
             return
         }
-        if err := forwardToExecutor("run_vm", map[string]string{"id": id}); err != nil {
-            log.Printf("executor run_vm failed: %v", err)
-            http.Error(w, "executor error", http.StatusBadGateway)
+        if path[i+1:] == "exec" {
+            handleVMExec(w, r, resolveVMID(path[:i]))
+            return
+        }
+        if path[i+1:] == "files" {
+            handleVMFiles(w, r, resolveVMID(path[:i]))
+            return
+        }
+        if path[i+1:] == "push" {
+            handleVMPush(w, r, resolveVMID(path[:i]))
             return
         }
-        w.WriteHeader(http.StatusOK)
-        json.NewEncoder(w).Encode(map[string]string{"result": "executed"})
-        return
     }
-    id := path
+    id := resolveVMID(path)
     switch r.Method {
     case http.MethodGet:
         vmMu.RLock()
@@ -145,11 +403,157 @@ func handleVMByID(w http.ResponseWriter, r *http.Request) {
             http.Error(w, "not found", http.StatusNotFound)
             return
         }
+        // Report the real power state so out-of-band stops show up as drift
+        if state, err := observeVMState(ctx, ent.Name); err != nil {
+            log.Printf("executor get_vm_state failed for %s: %v", id, err)
+        } else if state != "" && state != ent.Status {
+            ent.Status = state
+            vmMu.Lock()
+            if cur, ok := vmStore[id]; ok {
+                cur.Status = state
+                vmStore[id] = cur
+            }
+            vmMu.Unlock()
+        }
+        ent.Clones = clonesOf(id)
+        json.NewEncoder(w).Encode(ent)
+        return
+    case http.MethodPatch:
+        // A new name goes to tart rename and hardware to tart set; shared directories,
+        // network and disks only take effect on the next start
+        var payload struct {
+            Name string `json:"name"`
+            vmHardware
+            SharedDirectories *[]sharedDirectory `json:"shared_directories"`
+            Network           *vmNetwork         `json:"network"`
+            Disks             *[]attachedDisk    `json:"disks"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+            http.Error(w, "invalid json payload", http.StatusBadRequest)
+            return
+        }
+        vmMu.RLock()
+        ent, ok := vmStore[id]
+        vmMu.RUnlock()
+        if !ok {
+            http.Error(w, "not found", http.StatusNotFound)
+            return
+        }
+        if payload.CPU < 0 || payload.MemoryMB < 0 || payload.DiskSizeGB < 0 {
+            http.Error(w, "hardware values must be positive", http.StatusBadRequest)
+            return
+        }
+        // tart set cannot shrink a disk; callers must recreate the VM instead.
+        // Entries without a recorded size (adopted or older VMs) are checked against the host
+        currentDiskGB := ent.DiskSizeGB
+        if payload.DiskSizeGB > 0 && currentDiskGB == 0 {
+            host, err := lookupHostVM(ctx, ent.Name)
+            if err != nil {
+                log.Printf("executor get_vm_state failed for %s: %v", ent.Name, err)
+                http.Error(w, "executor error", http.StatusBadGateway)
+                return
+            }
+            currentDiskGB = host.DiskGB
+        }
+        if payload.DiskSizeGB > 0 && payload.DiskSizeGB < currentDiskGB {
+            http.Error(w, "disk_size_gb cannot be decreased", http.StatusBadRequest)
+            return
+        }
+        // tart set only applies to a stopped VM: CPU and memory would wait for a later
+        // reboot and the disk would be resized while the guest is using it
+        if !payload.isZero() {
+            if status := currentVMState(ctx, ent); status == "running" {
+                http.Error(w, fmt.Sprintf("VM %s is running; stop it before changing cpu, memory or disk size", ent.Name), http.StatusConflict)
+                return
+            }
+        }
+        if payload.SharedDirectories != nil {
+            if err := validateSharedDirs(*payload.SharedDirectories, sharedDirAllowlist()); err != nil {
+                writeSharedDirError(w, err)
+                return
+            }
+        }
+        if err := validateNetwork(payload.Network); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        if payload.Disks != nil {
+            if err := validateAttachedDisks(*payload.Disks); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+        }
+        rename := payload.Name != "" && payload.Name != ent.Name
+        if rename || !payload.isZero() {
+            if err := pushInProgress(id, ent.Name); err != nil {
+                http.Error(w, err.Error(), http.StatusConflict)
+                return
+            }
+        }
+        if rename {
+            if code, err := renameVM(ctx, id, ent.Name, payload.Name); err != nil {
+                http.Error(w, err.Error(), code)
+                return
+            }
+            ent.Name = payload.Name
+        }
+        if !payload.isZero() {
+            if err := setVMHardware(ctx, ent.Name, payload.vmHardware); err != nil {
+                log.Printf("executor set_vm failed: %v", err)
+                http.Error(w, "executor error", http.StatusBadGateway)
+                return
+            }
+        }
+        vmMu.Lock()
+        if payload.CPU > 0 {
+            ent.CPU = payload.CPU
+        }
+        if payload.MemoryMB > 0 {
+            ent.MemoryMB = payload.MemoryMB
+        }
+        if payload.DiskSizeGB > 0 {
+            ent.DiskSizeGB = payload.DiskSizeGB
+        }
+        if payload.SharedDirectories != nil {
+            ent.SharedDirectories = *payload.SharedDirectories
+        }
+        if payload.Network != nil {
+            ent.Network = payload.Network
+        }
+        if payload.Disks != nil {
+            ent.Disks = *payload.Disks
+        }
+        vmStore[id] = ent
+        vmMu.Unlock()
         json.NewEncoder(w).Encode(ent)
         return
     case http.MethodDelete:
         // Proxy delete to executor and enforce success
-        if err := forwardToExecutor("delete_vm", map[string]string{"id": id}); err != nil {
+        name := id
+        vmMu.RLock()
+        ent, managed := vmStore[id]
+        vmMu.RUnlock()
+        if managed {
+            name = ent.Name
+        }
+        // Only the creator may delete a VM; anything else on a shared host needs an explicit force
+        if r.URL.Query().Get("force") != "true" {
+            if !managed {
+                http.Error(w, fmt.Sprintf("VM %q is not managed by this controller; pass force=true to delete it anyway", name), http.StatusForbidden)
+                return
+            }
+            if err := checkOwnership(name, ent.Owner, requestOwner(r)); err != nil {
+                http.Error(w, err.Error(), http.StatusForbidden)
+                return
+            }
+        }
+        if managed {
+            if err := pushInProgress(id, name); err != nil {
+                http.Error(w, err.Error(), http.StatusConflict)
+                return
+            }
+        }
+        if err := forwardToExecutor(ctx, "delete_vm", map[string]string{"name": name}); err != nil {
             log.Printf("executor delete_vm failed: %v", err)
             http.Error(w, "executor error", http.StatusBadGateway)
             return
@@ -164,14 +568,505 @@ func handleVMByID(w http.ResponseWriter, r *http.Request) {
     }
 }
 
-func handleImages(w http.ResponseWriter, r *http.Request) {
+// cloneSource resolves the managed VM a new VM is cloned from. Tart copies
+// the source's disk, so it has to be stopped for the clone to be consistent.
+func cloneSource(ctx context.Context, key string) (vmEntry, int, error) {
+    id := resolveVMID(key)
+    vmMu.RLock()
+    source, ok := vmStore[id]
+    vmMu.RUnlock()
+    if !ok {
+        return vmEntry{}, http.StatusBadRequest, fmt.Errorf("source_vm %q is not a VM managed by this controller", key)
+    }
+    if status := currentVMState(ctx, source); status != "stopped" {
+        return vmEntry{}, http.StatusConflict, fmt.Errorf("source_vm %s is %s; stop it before cloning", source.Name, status)
+    }
+    return source, http.StatusOK, nil
+}
+
+// clonesOf lists the IDs of the VMs cloned from id.
+func clonesOf(id string) []string {
+    vmMu.RLock()
+    defer vmMu.RUnlock()
+    var clones []string
+    for childID, ent := range vmStore {
+        if ent.SourceVM == id {
+            clones = append(clones, childID)
+        }
+    }
+    sort.Strings(clones)
+    return clones
+}
+
+// renameVM renames the VM on the host with tart rename, keeping its disk and
+// controller ID. It returns the HTTP status to report on failure.
+func renameVM(ctx context.Context, id, oldName, newName string) (int, error) {
+    vmMu.RLock()
+    for otherID, other := range vmStore {
+        if otherID != id && other.Name == newName {
+            vmMu.RUnlock()
+            return http.StatusConflict, fmt.Errorf("a VM named %q already exists", newName)
+        }
+    }
+    ent := vmStore[id]
+    vmMu.RUnlock()
+    // tart rename moves the VM directory, which must not happen under a running VM
+    if ent.Status == "running" || ent.Status == "suspended" {
+        return http.StatusConflict, fmt.Errorf("stop VM %s before renaming it", oldName)
+    }
+    if err := forwardToExecutor(ctx, "rename_vm", map[string]string{"name": oldName, "new_name": newName}); err != nil {
+        log.Printf("executor rename_vm failed: %v", err)
+        return http.StatusBadGateway, fmt.Errorf("executor error")
+    }
+    vmMu.Lock()
+    if cur, ok := vmStore[id]; ok {
+        cur.Name = newName
+        vmStore[id] = cur
+    }
+    vmMu.Unlock()
+    return http.StatusOK, nil
+}
+
+// handleVMPower forwards a power transition to the executor and records the resulting status.
+func handleVMPower(w http.ResponseWriter, r *http.Request, id, action, status string) {
+    ctx := r.Context()
+    if r.Method != http.MethodPost {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    if id == "" {
+        http.Error(w, "missing id", http.StatusBadRequest)
+        return
+    }
+    // Optional body: { "detach": true } starts the VM in the background instead of blocking
+    var opts struct {
+        Detach bool `json:"detach"`
+    }
+    _ = json.NewDecoder(r.Body).Decode(&opts)
+    vmMu.RLock()
+    ent, known := vmStore[id]
+    vmMu.RUnlock()
+    if known && action == "suspend_vm" && ent.Status != "running" {
+        http.Error(w, "only running VMs can be suspended", http.StatusConflict)
+        return
+    }
+    if known && action == "run_vm" {
+        if err := pushInProgress(id, ent.Name); err != nil {
+            http.Error(w, err.Error(), http.StatusConflict)
+            return
+        }
+        vmMu.RLock()
+        err := diskInUse(id, ent.Disks)
+        vmMu.RUnlock()
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusConflict)
+            return
+        }
+    }
+    name := id
+    if known {
+        name = ent.Name
+    }
+    data := map[string]interface{}{"name": name}
+    if action == "run_vm" {
+        if opts.Detach {
+            data["detach"] = true
+        }
+        if len(ent.SharedDirectories) > 0 {
+            // The executor resolves symlinks on its host and checks the real paths against the allowlist again
+            data["dirs"] = ent.SharedDirectories
+            data["allowlist"] = sharedDirAllowlist()
+        }
+        if ent.Network != nil {
+            data["network"] = ent.Network
+        }
+        if len(ent.Disks) > 0 {
+            data["disks"] = ent.Disks
+        }
+    }
+    if err := forwardToExecutor(ctx, action, data); err != nil {
+        var se *executorStatusError
+        if errors.As(err, &se) && se.StatusCode == http.StatusForbidden {
+            http.Error(w, se.Message, http.StatusForbidden)
+            return
+        }
+        log.Printf("executor %s failed: %v", action, err)
+        http.Error(w, "executor error", http.StatusBadGateway)
+        return
+    }
+    if known {
+        vmMu.Lock()
+        if cur, ok := vmStore[id]; ok {
+            cur.Status = status
+            if status != "running" {
+                // The DHCP lease is gone once the VM stops
+                cur.IPAddress = ""
+            }
+            vmStore[id] = cur
+        }
+        vmMu.Unlock()
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]string{"result": "executed", "status": status})
+}
+
+// handleVMIP serves GET /api/vms/{id}/ip[?wait=seconds] through the executor's get_ip
+// action (tart ip --wait) and remembers the addresses on the VM entry.
+func handleVMIP(w http.ResponseWriter, r *http.Request, id string) {
+    ctx := r.Context()
+    if r.Method != http.MethodGet {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    vmMu.RLock()
+    ent, ok := vmStore[id]
+    vmMu.RUnlock()
+    if !ok {
+        http.Error(w, "not found", http.StatusNotFound)
+        return
+    }
+    wait := 0
+    if v := r.URL.Query().Get("wait"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 0 {
+            http.Error(w, "wait must be a non-negative number of seconds", http.StatusBadRequest)
+            return
+        }
+        wait = n
+    }
+    var res struct {
+        IP  string `json:"ip"`
+        MAC string `json:"mac"`
+    }
+    if err := forwardToExecutorResult(ctx, "get_ip", map[string]interface{}{"name": ent.Name, "wait": wait}, &res); err != nil {
+        log.Printf("executor get_ip failed: %v", err)
+        http.Error(w, "executor error", http.StatusBadGateway)
+        return
+    }
+    vmMu.Lock()
+    if cur, ok := vmStore[id]; ok {
+        cur.IPAddress = res.IP
+        if res.MAC != "" {
+            cur.MACAddress = res.MAC
+        }
+        vmStore[id] = cur
+    }
+    vmMu.Unlock()
+    json.NewEncoder(w).Encode(map[string]string{"ip_address": res.IP, "mac_address": res.MAC})
+}
+
+// runningVM looks up a managed VM for a guest agent request. It answers 404 or
+// 409 itself and reports false when the VM is unknown or not running.
+func runningVM(ctx context.Context, w http.ResponseWriter, id string) (vmEntry, bool) {
+    vmMu.RLock()
+    ent, ok := vmStore[id]
+    vmMu.RUnlock()
+    if !ok {
+        http.Error(w, "not found", http.StatusNotFound)
+        return ent, false
+    }
+    // The guest agent only answers while the VM runs
+    if state := currentVMState(ctx, ent); state != "" && state != "running" {
+        http.Error(w, fmt.Sprintf("VM %q is %s; the guest agent needs a running VM", ent.Name, state), http.StatusConflict)
+        return ent, false
+    }
+    return ent, true
+}
+
+// handleVMExec serves POST /api/vms/{id}/exec: run a command in the guest via the
+// Tart guest agent. A non-zero exit code is a result, not an error.
+func handleVMExec(w http.ResponseWriter, r *http.Request, id string) {
+    ctx := r.Context()
+    if r.Method != http.MethodPost {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    var payload struct {
+        Command        []string `json:"command"`
+        Stdin          *string  `json:"stdin,omitempty"`
+        TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+        http.Error(w, "invalid json payload", http.StatusBadRequest)
+        return
+    }
+    if len(payload.Command) == 0 {
+        http.Error(w, "missing command", http.StatusBadRequest)
+        return
+    }
+    if payload.TimeoutSeconds < 0 {
+        http.Error(w, "timeout_seconds must not be negative", http.StatusBadRequest)
+        return
+    }
+    ent, ok := runningVM(ctx, w, id)
+    if !ok {
+        return
+    }
+    var res guestExecResult
+    data := map[string]interface{}{"name": ent.Name, "command": payload.Command, "timeout_seconds": payload.TimeoutSeconds}
+    if payload.Stdin != nil {
+        data["stdin"] = *payload.Stdin
+    }
+    if err := forwardToExecutorResult(ctx, "exec_vm", data, &res); err != nil {
+        log.Printf("executor exec_vm failed: %v", err)
+        http.Error(w, "executor error", http.StatusBadGateway)
+        return
+    }
+    json.NewEncoder(w).Encode(res)
+}
+
+// hostVM is the executor's view of a VM from `tart list`.
+type hostVM struct {
+    Present bool   `json:"present"`
+    State   string `json:"state"`
+    DiskGB  int    `json:"disk_gb"`
+}
+
+// lookupHostVM reports whether a VM of that name exists on the executor host, its power state and disk size.
+func lookupHostVM(ctx context.Context, name string) (hostVM, error) {
+    var res hostVM
+    if err := forwardToExecutorResult(ctx, "get_vm_state", map[string]string{"name": name}, &res); err != nil {
+        return hostVM{}, err
+    }
+    return res, nil
+}
+
+// listUnmanagedVMs serves GET /api/vms?unmanaged=true: local VMs from `tart list`
+// that the controller does not manage, as candidates for adoption or import.
+func listUnmanagedVMs(ctx context.Context, w http.ResponseWriter) {
+    images, err := listExecutorImages(ctx)
+    if err != nil {
+        log.Printf("executor list_images failed: %v", err)
+        http.Error(w, "executor error", http.StatusBadGateway)
+        return
+    }
+    managed := map[string]bool{}
+    vmMu.RLock()
+    for _, ent := range vmStore {
+        managed[ent.Name] = true
+    }
+    vmMu.RUnlock()
+    list := []vmEntry{}
+    for _, img := range images {
+        if img.Source != "local" || managed[img.Name] {
+            continue
+        }
+        list = append(list, vmEntry{Name: img.Name, Status: img.State, DiskSizeGB: img.DiskGB})
+    }
+    json.NewEncoder(w).Encode(list)
+}
+
+// observeVMState asks the executor for the VM's current power state as seen by `tart list`.
+func observeVMState(ctx context.Context, name string) (string, error) {
+    vm, err := lookupHostVM(ctx, name)
+    return vm.State, err
+}
+
+// currentVMState is the managed VM's power state as the executor observes it. It falls
+// back to the stored status when the executor cannot be asked or does not report one.
+func currentVMState(ctx context.Context, ent vmEntry) string {
+    observed, err := observeVMState(ctx, ent.Name)
+    if err != nil {
+        log.Printf("executor get_vm_state failed for %s: %v", ent.Name, err)
+        return ent.Status
+    }
+    if observed == "" {
+        return ent.Status
+    }
+    return observed
+}
+
+// imageEntry describes a local Tart image or cached OCI image reported by the executor.
+type imageEntry struct {
+    ID           string `json:"id"`
+    Name         string `json:"name"`
+    Source       string `json:"source"`
+    DiskGB       int    `json:"disk_gb"`
+    SizeGB       int    `json:"size_gb"`
+    LastAccessed string `json:"last_accessed,omitempty"`
+    State        string `json:"state,omitempty"`
+}
+
+// listExecutorImages asks the executor for the host's local images and OCI cache.
+func listExecutorImages(ctx context.Context) ([]imageEntry, error) {
+    var res struct {
+        Images []imageEntry `json:"images"`
+    }
+    if err := forwardToExecutorResult(ctx, "list_images", nil, &res); err != nil {
+        return nil, err
+    }
+    for i := range res.Images {
+        res.Images[i].ID = res.Images[i].Name
+    }
+    if res.Images == nil {
+        res.Images = []imageEntry{}
+    }
+    return res.Images, nil
+}
+
+// handleInterfaces serves GET /api/interfaces: the host interfaces the executor can bridge VMs to.
+func handleInterfaces(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
     if r.Method != http.MethodGet {
         http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
         return
     }
-    // Return a dummy images list
-    images := []map[string]string{
-        {"id": "debian-13-arm64", "name": "Debian 13 (ARM64)"},
+    var res struct {
+        Interfaces []hostInterface `json:"interfaces"`
+    }
+    if err := forwardToExecutorResult(ctx, "list_interfaces", nil, &res); err != nil {
+        log.Printf("executor list_interfaces failed: %v", err)
+        http.Error(w, "executor error", http.StatusBadGateway)
+        return
+    }
+    if res.Interfaces == nil {
+        res.Interfaces = []hostInterface{}
+    }
+    json.NewEncoder(w).Encode(res.Interfaces)
+}
+
+// pulledImage describes an OCI image in the executor's Tart cache.
+type pulledImage struct {
+    ID           string `json:"id"`
+    Ref          string `json:"ref"`
+    Digest       string `json:"digest,omitempty"`
+    SizeGB       int    `json:"size_gb"`
+    RemoteDigest string `json:"remote_digest,omitempty"`
+}
+
+// inspectImage asks the executor whether ref is cached and, if so, for its digest and size.
+func inspectImage(ctx context.Context, ref string) (*pulledImage, bool, error) {
+    var res struct {
+        Present bool   `json:"present"`
+        Digest  string `json:"digest"`
+        SizeGB  int    `json:"size_gb"`
+    }
+    if err := forwardToExecutorResult(ctx, "image_info", map[string]string{"ref": ref}, &res); err != nil {
+        return nil, false, err
+    }
+    if !res.Present {
+        return nil, false, nil
+    }
+    return &pulledImage{ID: ref, Ref: ref, Digest: res.Digest, SizeGB: res.SizeGB}, true, nil
+}
+
+// resolveRemoteDigest asks the executor which digest the registry currently serves for ref,
+// authenticating with auth for private repositories.
+func resolveRemoteDigest(ctx context.Context, ref string, auth *registryCredential) (string, error) {
+    var res struct {
+        Digest string `json:"digest"`
+    }
+    // resolve_digest takes the same { ref, username?, password? } as pull_image
+    data, err := pullImageData(ref, auth)
+    if err != nil {
+        return "", err
+    }
+    if err := forwardToExecutorResult(ctx, "resolve_digest", data, &res); err != nil {
+        return "", err
+    }
+    return res.Digest, nil
+}
+
+func handleImages(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    switch r.Method {
+    case http.MethodGet:
+        images, err := listExecutorImages(ctx)
+        if err != nil {
+            log.Printf("executor list_images failed: %v", err)
+            http.Error(w, "executor error", http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(images)
+    case http.MethodPost:
+        // Pull (or re-pull) an OCI image into the executor's cache
+        var payload struct {
+            Ref          string              `json:"ref"`
+            RegistryAuth *registryCredential `json:"registry_auth"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+            http.Error(w, "invalid json payload", http.StatusBadRequest)
+            return
+        }
+        if !isRegistryRef(payload.Ref) || strings.HasPrefix(payload.Ref, "http://") || strings.HasPrefix(payload.Ref, "https://") {
+            http.Error(w, "ref must be an OCI registry reference", http.StatusBadRequest)
+            return
+        }
+        pullData, err := pullImageData(payload.Ref, payload.RegistryAuth)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        if err := forwardToExecutor(ctx, "pull_image", pullData); err != nil {
+            log.Printf("executor pull_image failed: %v", err)
+            http.Error(w, "executor error", http.StatusBadGateway)
+            return
+        }
+        img, ok, err := inspectImage(ctx, payload.Ref)
+        if err != nil {
+            log.Printf("executor image_info failed: %v", err)
+            http.Error(w, "executor error", http.StatusBadGateway)
+            return
+        }
+        if !ok {
+            img = &pulledImage{ID: payload.Ref, Ref: payload.Ref}
+        }
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(img)
+    default:
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+// handleImageByRef serves /api/images/{ref}; the ref keeps its slashes, e.g.
+// /api/images/ghcr.io/cirruslabs/ubuntu:latest. GET accepts ?remote=true to also
+// report the digest the registry currently serves, with credentials for private
+// repositories in the X-Tart-Registry-Auth header.
+func handleImageByRef(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    ref := strings.TrimPrefix(r.URL.Path, "/api/images/")
+    if ref == "" {
+        http.Error(w, "missing ref", http.StatusBadRequest)
+        return
+    }
+    switch r.Method {
+    case http.MethodGet:
+        img, ok, err := inspectImage(ctx, ref)
+        if err != nil {
+            log.Printf("executor image_info failed: %v", err)
+            http.Error(w, "executor error", http.StatusBadGateway)
+            return
+        }
+        if !ok {
+            http.Error(w, "not found", http.StatusNotFound)
+            return
+        }
+        if r.URL.Query().Get("remote") == "true" {
+            auth, err := requestRegistryAuth(r)
+            if err == nil {
+                err = checkRegistryAuth(ref, auth)
+            }
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            digest, err := resolveRemoteDigest(ctx, ref, auth)
+            if err != nil {
+                log.Printf("executor resolve_digest failed: %v", err)
+                http.Error(w, "executor error", http.StatusBadGateway)
+                return
+            }
+            img.RemoteDigest = digest
+        }
+        json.NewEncoder(w).Encode(img)
+    case http.MethodDelete:
+        if err := forwardToExecutor(ctx, "delete_image", map[string]string{"ref": ref}); err != nil {
+            log.Printf("executor delete_image failed: %v", err)
+            http.Error(w, "executor error", http.StatusBadGateway)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+    default:
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
     }
-    json.NewEncoder(w).Encode(images)
 }
@@ -0,0 +1,190 @@
+package tart
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// diskEntry is a raw data disk in the executor's disk directory.
+type diskEntry struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	SizeGB int    `json:"size_gb"`
+	Label  string `json:"label,omitempty"`
+}
+
+// attachedDisk is a data disk passed to `tart run --disk` when the VM starts.
+type attachedDisk struct {
+	Name     string `json:"name"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+func validateAttachedDisks(disks []attachedDisk) error {
+	seen := map[string]bool{}
+	for _, d := range disks {
+		if d.Name == "" {
+			return fmt.Errorf("attached disk needs a name")
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("disk %q is attached twice", d.Name)
+		}
+		seen[d.Name] = true
+	}
+	return nil
+}
+
+// vmsAttachingDisk returns the names of VMs that attach the disk, sorted. The caller holds vmMu.
+func vmsAttachingDisk(disk string) []string {
+	var names []string
+	for _, ent := range vmStore {
+		for _, d := range ent.Disks {
+			if d.Name == disk {
+				names = append(names, ent.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// diskInUse reports a running VM other than id that attaches one of disks,
+// when either VM may write to it; a raw image cannot be shared that way.
+// The caller holds vmMu.
+func diskInUse(id string, disks []attachedDisk) error {
+	for otherID, other := range vmStore {
+		if otherID == id || (other.Status != "running" && other.Status != "suspended") {
+			continue
+		}
+		for _, d := range disks {
+			for _, od := range other.Disks {
+				if od.Name == d.Name && !(d.ReadOnly && od.ReadOnly) {
+					return fmt.Errorf("disk %s is attached to running VM %s", d.Name, other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// inspectDisk asks the executor for a disk; ok is false when it does not exist.
+func inspectDisk(ctx context.Context, name string) (*diskEntry, bool, error) {
+	var res struct {
+		Present bool      `json:"present"`
+		Disk    diskEntry `json:"disk"`
+	}
+	if err := forwardToExecutorResult(ctx, "disk_info", map[string]string{"name": name}, &res); err != nil {
+		return nil, false, err
+	}
+	return &res.Disk, res.Present, nil
+}
+
+// handleDisks serves POST /api/disks, creating a sparse raw disk on the executor.
+func handleDisks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload struct {
+		Name   string `json:"name"`
+		SizeGB int    `json:"size_gb"`
+		Label  string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid json payload", http.StatusBadRequest)
+		return
+	}
+	if payload.Name == "" || payload.SizeGB <= 0 {
+		http.Error(w, "missing name or size_gb", http.StatusBadRequest)
+		return
+	}
+	_, exists, err := inspectDisk(ctx, payload.Name)
+	if err != nil {
+		log.Printf("executor disk_info failed: %v", err)
+		http.Error(w, "executor error", http.StatusBadGateway)
+		return
+	}
+	if exists {
+		http.Error(w, "disk already exists", http.StatusConflict)
+		return
+	}
+	var res struct {
+		Disk diskEntry `json:"disk"`
+	}
+	if err := forwardToExecutorResult(ctx, "create_disk", payload, &res); err != nil {
+		log.Printf("executor create_disk failed: %v", err)
+		http.Error(w, "executor error", http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res.Disk)
+}
+
+// handleDiskByName serves GET, PATCH (grow) and DELETE on /api/disks/{name}.
+func handleDiskByName(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := strings.TrimPrefix(r.URL.Path, "/api/disks/")
+	if name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodPatch:
+		disk, ok, err := inspectDisk(ctx, name)
+		if err != nil {
+			log.Printf("executor disk_info failed: %v", err)
+			http.Error(w, "executor error", http.StatusBadGateway)
+			return
+		}
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(disk)
+			return
+		}
+		var payload struct {
+			SizeGB int `json:"size_gb"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid json payload", http.StatusBadRequest)
+			return
+		}
+		if payload.SizeGB < disk.SizeGB {
+			http.Error(w, "size_gb cannot be decreased", http.StatusBadRequest)
+			return
+		}
+		var res struct {
+			Disk diskEntry `json:"disk"`
+		}
+		if err := forwardToExecutorResult(ctx, "resize_disk", map[string]interface{}{"name": name, "size_gb": payload.SizeGB}, &res); err != nil {
+			log.Printf("executor resize_disk failed: %v", err)
+			http.Error(w, "executor error", http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(res.Disk)
+	case http.MethodDelete:
+		vmMu.RLock()
+		users := vmsAttachingDisk(name)
+		vmMu.RUnlock()
+		if len(users) > 0 {
+			http.Error(w, fmt.Sprintf("disk %s is attached to %s; detach it first", name, strings.Join(users, ", ")), http.StatusConflict)
+			return
+		}
+		if err := forwardToExecutor(ctx, "delete_disk", map[string]string{"name": name}); err != nil {
+			log.Printf("executor delete_disk failed: %v", err)
+			http.Error(w, "executor error", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
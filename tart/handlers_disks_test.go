@@ -0,0 +1,144 @@
+package tart
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// startDiskExecutor fakes the executor's disk actions with an in-memory map of sizes.
+func startDiskExecutor(t *testing.T, runData *json.RawMessage) {
+	t.Helper()
+	disks := map[string]int{}
+	startExecutorFunc(t, func(action string, raw json.RawMessage) string {
+		var data struct {
+			Name   string `json:"name"`
+			SizeGB int    `json:"size_gb"`
+		}
+		_ = json.Unmarshal(raw, &data)
+		disk := map[string]interface{}{"name": data.Name, "path": "/disks/" + data.Name + ".img", "size_gb": data.SizeGB}
+		switch action {
+		case "create_disk", "resize_disk":
+			disks[data.Name] = data.SizeGB
+			b, _ := json.Marshal(map[string]interface{}{"result": "executed", "disk": disk})
+			return string(b)
+		case "disk_info":
+			size, ok := disks[data.Name]
+			disk["size_gb"] = size
+			b, _ := json.Marshal(map[string]interface{}{"result": "executed", "present": ok, "disk": disk})
+			return string(b)
+		case "delete_disk":
+			delete(disks, data.Name)
+		case "run_vm":
+			if runData != nil {
+				*runData = raw
+			}
+		}
+		return ""
+	})
+}
+
+func doJSON(t *testing.T, method, url, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	return resp
+}
+
+func TestHandleDisks(t *testing.T) {
+	startDiskExecutor(t, nil)
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+
+	steps := []struct {
+		method, path, body string
+		wantCode           int
+	}{
+		{http.MethodPost, "/api/disks", `{"name":"cache","size_gb":20}`, http.StatusCreated},
+		{http.MethodPost, "/api/disks", `{"name":"cache","size_gb":20}`, http.StatusConflict},
+		{http.MethodPost, "/api/disks", `{"name":"nosize"}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/disks/cache", "", http.StatusOK},
+		{http.MethodPatch, "/api/disks/cache", `{"size_gb":10}`, http.StatusBadRequest},
+		{http.MethodPatch, "/api/disks/cache", `{"size_gb":40}`, http.StatusOK},
+		{http.MethodPatch, "/api/disks/missing", `{"size_gb":40}`, http.StatusNotFound},
+		{http.MethodDelete, "/api/disks/cache", "", http.StatusNoContent},
+		{http.MethodGet, "/api/disks/cache", "", http.StatusNotFound},
+	}
+	for _, st := range steps {
+		resp := doJSON(t, st.method, srv.URL+st.path, st.body)
+		resp.Body.Close()
+		if resp.StatusCode != st.wantCode {
+			t.Fatalf("%s %s %s: expected %d, got %d", st.method, st.path, st.body, st.wantCode, resp.StatusCode)
+		}
+	}
+}
+
+// Attached disks are stored on the VM and handed to run_vm on start.
+func TestHandleVMs_AttachDisk(t *testing.T) {
+	var runData json.RawMessage
+	startDiskExecutor(t, &runData)
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/vms", `{"name":"disk-vm","image":"base","disks":[{"name":"cache"},{"name":"cache"}]}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a disk attached twice, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/vms", `{"name":"disk-vm","image":"base","disks":[{"name":"cache","read_only":true}]}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/vms/disk-vm/run", `{"detach":true}`)
+	resp.Body.Close()
+	var got struct {
+		Disks []attachedDisk `json:"disks"`
+	}
+	_ = json.Unmarshal(runData, &got)
+	if len(got.Disks) != 1 || got.Disks[0].Name != "cache" || !got.Disks[0].ReadOnly {
+		t.Fatalf("expected the disk in run_vm, got %s", runData)
+	}
+}
+
+// A disk cannot be deleted while a VM attaches it, nor written by two running VMs.
+func TestHandleDisks_AttachedDiskConflicts(t *testing.T) {
+	startDiskExecutor(t, nil)
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+	vmMu.Lock()
+	vmStore["vm-db-a"] = vmEntry{ID: "vm-db-a", Name: "db-a", Status: "running", Disks: []attachedDisk{{Name: "pgdata"}}}
+	vmStore["vm-db-b"] = vmEntry{ID: "vm-db-b", Name: "db-b", Status: "stopped", Disks: []attachedDisk{{Name: "pgdata", ReadOnly: true}}}
+	vmStore["vm-db-c"] = vmEntry{ID: "vm-db-c", Name: "db-c", Status: "stopped", Disks: []attachedDisk{{Name: "seeds", ReadOnly: true}}}
+	vmStore["vm-db-d"] = vmEntry{ID: "vm-db-d", Name: "db-d", Status: "running", Disks: []attachedDisk{{Name: "seeds", ReadOnly: true}}}
+	vmMu.Unlock()
+	t.Cleanup(func() {
+		vmMu.Lock()
+		for _, id := range []string{"vm-db-a", "vm-db-b", "vm-db-c", "vm-db-d"} {
+			delete(vmStore, id)
+		}
+		vmMu.Unlock()
+	})
+
+	steps := []struct {
+		method, path string
+		wantCode     int
+	}{
+		{http.MethodPost, "/api/vms/vm-db-b/run", http.StatusConflict},
+		{http.MethodPost, "/api/vms/vm-db-c/run", http.StatusOK},
+		{http.MethodDelete, "/api/disks/pgdata", http.StatusConflict},
+		{http.MethodDelete, "/api/disks/scratch", http.StatusNoContent},
+	}
+	for _, st := range steps {
+		resp := doJSON(t, st.method, srv.URL+st.path, "")
+		resp.Body.Close()
+		if resp.StatusCode != st.wantCode {
+			t.Fatalf("%s %s: expected %d, got %d", st.method, st.path, st.wantCode, resp.StatusCode)
+		}
+	}
+}
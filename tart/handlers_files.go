@@ -0,0 +1,126 @@
+package tart
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// statFileScript prints the SHA-256 and octal mode of $1, or exits 3 if it is missing.
+// Linux guests have sha256sum and GNU stat, macOS guests shasum and BSD stat.
+const statFileScript = `[ -f "$1" ] || exit 3
+if command -v sha256sum >/dev/null 2>&1; then sha256sum "$1"; else shasum -a 256 "$1"; fi
+stat -c %a "$1" 2>/dev/null || stat -f %Lp "$1"`
+
+var fileModePattern = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+// guestFile describes a file placed in a VM through the guest agent.
+type guestFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Mode   string `json:"mode,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// handleVMFiles serves /api/vms/{id}/files?path=<guest path>: PUT streams the
+// request body into the guest, GET reports the file's hash and mode, DELETE removes it.
+func handleVMFiles(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	dest := r.URL.Query().Get("path")
+	if !path.IsAbs(dest) || path.Clean(dest) != dest {
+		http.Error(w, "path must be an absolute, clean guest path", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = "0644"
+		}
+		if !fileModePattern.MatchString(mode) {
+			http.Error(w, "mode must be octal, e.g. 0644", http.StatusBadRequest)
+			return
+		}
+		ent, ok := runningVM(ctx, w, id)
+		if !ok {
+			return
+		}
+		var res guestFile
+		q := url.Values{"name": {ent.Name}, "path": {dest}, "mode": {mode}}
+		if err := streamToExecutor(ctx, q, r.Body, &res); err != nil {
+			log.Printf("executor write_file failed: %v", err)
+			http.Error(w, "executor error", http.StatusBadGateway)
+			return
+		}
+		res.Path = dest
+		res.Mode = mode
+		json.NewEncoder(w).Encode(res)
+	case http.MethodGet:
+		ent, ok := runningVM(ctx, w, id)
+		if !ok {
+			return
+		}
+		res, err := guestExec(ctx, ent.Name, "/bin/sh", "-c", statFileScript, "sh", dest)
+		if err != nil {
+			log.Printf("executor exec_vm failed: %v", err)
+			http.Error(w, "executor error", http.StatusBadGateway)
+			return
+		}
+		if res.ExitCode == 3 {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		lines := strings.Fields(res.Stdout)
+		if res.ExitCode != 0 || len(lines) < 3 {
+			log.Printf("stat of %s in %s failed (%d): %s", dest, ent.Name, res.ExitCode, res.Stderr)
+			http.Error(w, "executor error", http.StatusBadGateway)
+			return
+		}
+		// sha256sum prints "<hash>  <path>"; the mode is the last line
+		mode := lines[len(lines)-1]
+		if len(mode) == 3 {
+			mode = "0" + mode
+		}
+		json.NewEncoder(w).Encode(guestFile{Path: dest, SHA256: lines[0], Mode: mode})
+	case http.MethodDelete:
+		ent, ok := runningVM(ctx, w, id)
+		if !ok {
+			return
+		}
+		res, err := guestExec(ctx, ent.Name, "rm", "-f", dest)
+		if err != nil {
+			log.Printf("executor exec_vm failed: %v", err)
+			http.Error(w, "executor error", http.StatusBadGateway)
+			return
+		}
+		// rm -f ignores a missing file, so any failure means the file is still there
+		if res.ExitCode != 0 {
+			log.Printf("rm of %s in %s failed (%d): %s", dest, ent.Name, res.ExitCode, res.Stderr)
+			http.Error(w, fmt.Sprintf("removing %s failed: %s", dest, strings.TrimSpace(res.Stderr)), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// guestExecResult is the executor's answer to exec_vm.
+type guestExecResult struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+}
+
+// guestExec runs command in the named VM through the executor's exec_vm action.
+func guestExec(ctx context.Context, name string, command ...string) (guestExecResult, error) {
+	var res guestExecResult
+	err := forwardToExecutorResult(ctx, "exec_vm", map[string]interface{}{"name": name, "command": command}, &res)
+	return res, err
+}
@@ -0,0 +1,92 @@
+package tart
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleVMFiles(t *testing.T) {
+	var uploaded, uploadQuery string
+	files := map[string]bool{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		uploaded, uploadQuery = string(b), r.URL.RawQuery
+		files[r.URL.Query().Get("path")] = true
+		_, _ = w.Write([]byte(`{"result":"executed","sha256":"abc123","size":5}`))
+	})
+	mux.HandleFunc("/execute", fakeExecutor(func(action string, data json.RawMessage) string {
+		var req struct {
+			Command []string `json:"command"`
+		}
+		_ = json.Unmarshal(data, &req)
+		switch {
+		case action == "get_vm_state":
+			return `{"result":"executed","present":true,"state":"running"}`
+		case action == "exec_vm" && req.Command[0] == "rm" && strings.HasPrefix(req.Command[2], "/ro/"):
+			return `{"result":"executed","exit_code":1,"stderr":"rm: cannot remove '/ro/app.conf': Read-only file system\n"}`
+		case action == "exec_vm" && req.Command[0] == "rm":
+			delete(files, req.Command[2])
+			return `{"result":"executed","exit_code":0}`
+		case action == "exec_vm":
+			if !files[req.Command[len(req.Command)-1]] {
+				return `{"result":"executed","exit_code":3}`
+			}
+			return `{"result":"executed","exit_code":0,"stdout":"abc123  /etc/app.conf\n600\n"}`
+		}
+		return ""
+	}))
+	serveExecutor(t, mux)
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+
+	vmMu.Lock()
+	vmStore["vm-files"] = vmEntry{ID: "vm-files", Name: "files-vm", Status: "running"}
+	vmMu.Unlock()
+	defer func() {
+		vmMu.Lock()
+		delete(vmStore, "vm-files")
+		vmMu.Unlock()
+	}()
+	base := srv.URL + "/api/vms/vm-files/files?path="
+
+	if resp := doJSON(t, http.MethodPut, base+"etc/app.conf", "hello"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a relative path, got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, http.MethodGet, base+"/etc/app.conf", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 before upload, got %d", resp.StatusCode)
+	}
+	resp := doJSON(t, http.MethodPut, base+"/etc/app.conf&mode=0600", "hello")
+	var put guestFile
+	_ = json.NewDecoder(resp.Body).Decode(&put)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || put.SHA256 != "abc123" || put.Path != "/etc/app.conf" {
+		t.Fatalf("unexpected upload result %d %+v", resp.StatusCode, put)
+	}
+	if uploaded != "hello" || !strings.Contains(uploadQuery, "name=files-vm") || !strings.Contains(uploadQuery, "mode=0600") {
+		t.Fatalf("unexpected upload to executor: %q ?%s", uploaded, uploadQuery)
+	}
+	resp = doJSON(t, http.MethodGet, base+"/etc/app.conf", "")
+	var got guestFile
+	_ = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if got.SHA256 != "abc123" || got.Mode != "0600" {
+		t.Fatalf("unexpected file info %+v", got)
+	}
+	if resp := doJSON(t, http.MethodDelete, base+"/etc/app.conf", ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 on delete, got %d", resp.StatusCode)
+	}
+	if files["/etc/app.conf"] {
+		t.Fatalf("expected the file to be removed")
+	}
+	resp = doJSON(t, http.MethodDelete, base+"/ro/app.conf", "")
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(b), "Read-only file system") {
+		t.Fatalf("expected 502 with the guest's stderr when rm fails, got %d %q", resp.StatusCode, b)
+	}
+}
@@ -0,0 +1,131 @@
+package tart
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Exercises the /api/images pull, inspect and delete flow against a scripted executor
+// that tracks which refs are cached.
+func TestImageEndpoints_PullInspectDelete(t *testing.T) {
+	var mu sync.Mutex
+	cached := map[string]bool{}
+	startExecutorFunc(t, func(action string, data json.RawMessage) string {
+		var req map[string]string
+		_ = json.Unmarshal(data, &req)
+		mu.Lock()
+		defer mu.Unlock()
+		switch action {
+		case "pull_image":
+			cached[req["ref"]] = true
+		case "image_info":
+			if cached[req["ref"]] {
+				return `{"result":"executed","present":true,"digest":"sha256:aaa","size_gb":12}`
+			}
+			return `{"result":"executed","present":false}`
+		case "resolve_digest":
+			return `{"result":"executed","digest":"sha256:bbb"}`
+		case "delete_image":
+			delete(cached, req["ref"])
+		}
+		return ""
+	})
+
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+	const ref = "ghcr.io/cirruslabs/macos-sequoia-base:latest"
+
+	body, _ := json.Marshal(map[string]string{"ref": ref})
+	resp, err := http.Post(srv.URL+"/api/images", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("pull request failed: %v", err)
+	}
+	var pulled pulledImage
+	_ = json.NewDecoder(resp.Body).Decode(&pulled)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || pulled.Digest != "sha256:aaa" || pulled.SizeGB != 12 {
+		t.Fatalf("unexpected pull response %d: %+v", resp.StatusCode, pulled)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/images/" + ref + "?remote=true")
+	if err != nil {
+		t.Fatalf("get request failed: %v", err)
+	}
+	var got pulledImage
+	_ = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || got.Ref != ref || got.RemoteDigest != "sha256:bbb" {
+		t.Fatalf("unexpected get response %d: %+v", resp.StatusCode, got)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/api/images/"+ref, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("delete request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 on delete, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/images/" + ref)
+	if err != nil {
+		t.Fatalf("get request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", resp.StatusCode)
+	}
+}
+
+func TestImageEndpoints_RejectsLocalName(t *testing.T) {
+	_ = startFakeExecutor(t)
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/api/images", "application/json", bytes.NewReader([]byte(`{"ref":"sequoia-base"}`)))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a local image name, got %d", resp.StatusCode)
+	}
+}
+
+// The remote digest lookup for a private repository carries the registry credentials to the executor.
+func TestGetImage_RemoteDigestWithCredentials(t *testing.T) {
+	var resolved map[string]string
+	startExecutorFunc(t, func(action string, data json.RawMessage) string {
+		switch action {
+		case "image_info":
+			return `{"result":"executed","present":true,"digest":"sha256:aaa"}`
+		case "resolve_digest":
+			_ = json.Unmarshal(data, &resolved)
+			return `{"result":"executed","digest":"sha256:bbb"}`
+		}
+		return ""
+	})
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+	conf := &config{ApiURL: srv.URL + "/api"}
+	const ref = "ghcr.io/acme/private:latest"
+
+	img, err := getImage(context.Background(), conf, ref, true, &registryCredential{Host: "ghcr.io", Username: "bot", Password: "secret"})
+	if err != nil {
+		t.Fatalf("getImage failed: %v", err)
+	}
+	if img.RemoteDigest != "sha256:bbb" || resolved["ref"] != ref || resolved["username"] != "bot" || resolved["password"] != "secret" {
+		t.Fatalf("expected resolve_digest with credentials, got %v (%+v)", resolved, img)
+	}
+
+	_, err = getImage(context.Background(), conf, ref, true, &registryCredential{Host: "quay.io", Username: "bot", Password: "secret"})
+	if apiStatus(err) != http.StatusBadRequest {
+		t.Fatalf("expected 400 for credentials of another registry, got %v", err)
+	}
+}
@@ -55,3 +55,31 @@ func TestHandleVMsPost_LocalImage_SkipsPull(t *testing.T) {
 		t.Fatalf("expected exactly one clone_vm call, got %d", cloneCount)
 	}
 }
+
+// Verifies that cloud-init fields on create are forwarded to the executor as a create_seed action.
+func TestHandleVMsPost_CloudInit_CreatesSeed(t *testing.T) {
+	var seed map[string]string
+
+	startExecutorFunc(t, func(action string, data json.RawMessage) string {
+		if action == "create_seed" {
+			_ = json.Unmarshal(data, &seed)
+		}
+		return ""
+	})
+
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+
+	body, _ := json.Marshal(map[string]string{"name": "vm-seeded", "image": "localimage", "user_data": "#cloud-config\nhostname: seeded\n"})
+	resp, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	if seed == nil || seed["name"] != "vm-seeded" || seed["user_data"] != "#cloud-config\nhostname: seeded\n" {
+		t.Fatalf("expected create_seed with user_data, got %v", seed)
+	}
+}
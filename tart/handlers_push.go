@@ -0,0 +1,182 @@
+package tart
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pushJob tracks a `tart push` running in the background; pushing a macOS VM
+// can take far longer than any client should hold a request open.
+type pushJob struct {
+	ID         string     `json:"id"`
+	VMID       string     `json:"vm_id"`
+	Refs       []string   `json:"refs"`
+	Status     string     `json:"status"` // running, succeeded or failed
+	Digest     string     `json:"digest,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+var (
+	pushMu   sync.RWMutex
+	pushJobs = map[string]pushJob{}
+)
+
+// pushJobTTL is how long a finished job stays around for its poller to read.
+var pushJobTTL = time.Hour
+
+// prunePushJobs drops jobs that finished more than pushJobTTL before now. The caller holds pushMu.
+func prunePushJobs(now time.Time) {
+	for id, job := range pushJobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > pushJobTTL {
+			delete(pushJobs, id)
+		}
+	}
+}
+
+// activePush returns the running push job of the VM, if any. The caller holds pushMu.
+func activePush(vmID string) (pushJob, bool) {
+	for _, job := range pushJobs {
+		if job.VMID == vmID && job.Status == "running" {
+			return job, true
+		}
+	}
+	return pushJob{}, false
+}
+
+// pushInProgress reports a running push of the VM as an error. tart push reads the VM's
+// bundle, so the VM must not be started, renamed, resized or deleted until it is done.
+func pushInProgress(vmID, name string) error {
+	pushMu.RLock()
+	defer pushMu.RUnlock()
+	if job, ok := activePush(vmID); ok {
+		return fmt.Errorf("VM %s is being pushed by %s; wait for the push to finish", name, job.ID)
+	}
+	return nil
+}
+
+// pushRefs returns ref followed by the same repository under each extra tag.
+func pushRefs(ref string, tags []string) ([]string, error) {
+	if !isRegistryRef(ref) || registryHost(ref) == "" || strings.Contains(ref, "@") || strings.Contains(ref, "://") {
+		return nil, fmt.Errorf("ref must be an OCI registry reference with a tag, e.g. ghcr.io/org/image:tag")
+	}
+	repo := ref
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		repo = ref[:i]
+	}
+	refs := []string{ref}
+	for _, tag := range tags {
+		if tag == "" || strings.ContainsAny(tag, ":/@") {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		refs = append(refs, repo+":"+tag)
+	}
+	return refs, nil
+}
+
+// handleVMPush serves POST /api/vms/{id}/push: it starts pushing the stopped VM
+// and answers 202 with a job to poll at /api/pushes/{job}.
+func handleVMPush(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload struct {
+		Ref          string              `json:"ref"`
+		Tags         []string            `json:"tags"`
+		RegistryAuth *registryCredential `json:"registry_auth"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid json payload", http.StatusBadRequest)
+		return
+	}
+	refs, err := pushRefs(payload.Ref, payload.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkRegistryAuth(payload.Ref, payload.RegistryAuth); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vmMu.RLock()
+	ent, ok := vmStore[id]
+	vmMu.RUnlock()
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	// Like a clone, a push copies the disk, which has to be at rest
+	if status := currentVMState(ctx, ent); status != "stopped" {
+		http.Error(w, fmt.Sprintf("VM %s is %s; stop it before pushing", ent.Name, status), http.StatusConflict)
+		return
+	}
+	job := pushJob{ID: "push-" + strings.TrimPrefix(newVMID(), "vm-"), VMID: id, Refs: refs, Status: "running", StartedAt: time.Now().UTC()}
+	pushMu.Lock()
+	if other, ok := activePush(id); ok {
+		pushMu.Unlock()
+		http.Error(w, fmt.Sprintf("VM %s is already being pushed by %s", ent.Name, other.ID), http.StatusConflict)
+		return
+	}
+	prunePushJobs(job.StartedAt)
+	pushJobs[job.ID] = job
+	pushMu.Unlock()
+
+	data := map[string]interface{}{"name": ent.Name, "refs": refs}
+	if auth := payload.RegistryAuth; auth != nil {
+		data["username"] = auth.Username
+		data["password"] = auth.Password
+	}
+	go runPush(job.ID, data)
+
+	w.Header().Set("Location", "/api/pushes/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// runPush forwards push_vm to the executor and records the outcome on the job.
+func runPush(jobID string, data map[string]interface{}) {
+	var res struct {
+		Digest string `json:"digest"`
+	}
+	// The job outlives the request that started it, so it is not bound to its context
+	err := forwardToExecutorResult(context.Background(), "push_vm", data, &res)
+	now := time.Now().UTC()
+	pushMu.Lock()
+	defer pushMu.Unlock()
+	job := pushJobs[jobID]
+	job.FinishedAt = &now
+	if err != nil {
+		log.Printf("executor push_vm failed for %s: %v", jobID, err)
+		job.Status = "failed"
+		job.Error = err.Error()
+	} else {
+		job.Status = "succeeded"
+		job.Digest = res.Digest
+	}
+	pushJobs[jobID] = job
+}
+
+// handlePushByID serves GET /api/pushes/{job}.
+func handlePushByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pushMu.RLock()
+	job, ok := pushJobs[strings.TrimPrefix(r.URL.Path, "/api/pushes/")]
+	pushMu.RUnlock()
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(job)
+}
@@ -3,12 +3,50 @@ package tart
 import (
     "bytes"
     "encoding/json"
+    "io"
     "net/http"
     "net/http/httptest"
     "os"
+    "strings"
     "testing"
 )
 
+// fakeExecutor answers /execute with the JSON that reply returns for each action;
+// an empty reply (or a nil reply func) means {"result":"executed"}.
+func fakeExecutor(reply func(action string, data json.RawMessage) string) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        var req struct {
+            Action string          `json:"action"`
+            Data   json.RawMessage `json:"data"`
+        }
+        _ = json.NewDecoder(r.Body).Decode(&req)
+        body := ""
+        if reply != nil {
+            body = reply(req.Action, req.Data)
+        }
+        if body == "" {
+            body = `{"result":"executed"}`
+        }
+        w.Header().Set("Content-Type", "application/json")
+        _, _ = w.Write([]byte(body))
+    }
+}
+
+// serveExecutor starts h as the executor that EXECUTOR_URL points at for the rest of the test.
+func serveExecutor(t *testing.T, h http.Handler) *httptest.Server {
+    t.Helper()
+    srv := httptest.NewServer(h)
+    t.Cleanup(srv.Close)
+    t.Setenv("EXECUTOR_URL", srv.URL)
+    return srv
+}
+
+// startExecutorFunc serves fakeExecutor(reply) as the executor.
+func startExecutorFunc(t *testing.T, reply func(action string, data json.RawMessage) string) *httptest.Server {
+    t.Helper()
+    return serveExecutor(t, fakeExecutor(reply))
+}
+
 // startFakeExecutor spins up a dummy executor that always returns 200 with a JSON body
 // so unit tests don't depend on the real executor binary or Tart.
 func startFakeExecutor(t *testing.T) *httptest.Server {
@@ -116,6 +154,7 @@ func TestHandleVMByIDDelete(t *testing.T) {
 }
 
 func TestHandleImagesGet(t *testing.T) {
+    _ = startFakeExecutor(t)
     srv := httptest.NewServer(SetupRouter())
     defer srv.Close()
 
@@ -128,3 +167,687 @@ func TestHandleImagesGet(t *testing.T) {
         t.Fatalf("expected 200, got %d", resp.StatusCode)
     }
 }
+
+func TestHandleVMByIDPatch(t *testing.T) {
+    _ = startFakeExecutor(t)
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    createBody, _ := json.Marshal(map[string]interface{}{"name": "patch-vm", "image": "debian-13-arm64", "disk_size_gb": 50})
+    respCreate, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(createBody))
+    if err != nil {
+        t.Fatalf("create request failed: %v", err)
+    }
+    respCreate.Body.Close()
+    if respCreate.StatusCode != http.StatusCreated {
+        t.Fatalf("expected 201 on create, got %d", respCreate.StatusCode)
+    }
+
+    patchBody, _ := json.Marshal(map[string]int{"cpu": 4, "memory_mb": 8192})
+    req, _ := http.NewRequest(http.MethodPatch, srv.URL+"/api/vms/patch-vm", bytes.NewReader(patchBody))
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("expected 200, got %d", resp.StatusCode)
+    }
+    var got vmEntry
+    if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+        t.Fatalf("decode failed: %v", err)
+    }
+    if got.CPU != 4 || got.MemoryMB != 8192 || got.DiskSizeGB != 50 {
+        t.Fatalf("unexpected hardware after patch: %+v", got)
+    }
+
+    // Shrinking the disk must be rejected
+    shrinkBody, _ := json.Marshal(map[string]int{"disk_size_gb": 20})
+    req, _ = http.NewRequest(http.MethodPatch, srv.URL+"/api/vms/patch-vm", bytes.NewReader(shrinkBody))
+    resp2, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    resp2.Body.Close()
+    if resp2.StatusCode != http.StatusBadRequest {
+        t.Fatalf("expected 400 on disk shrink, got %d", resp2.StatusCode)
+    }
+}
+
+// Verifies that the shrink check falls back to the host's disk size when the entry has none recorded.
+func TestHandleVMByIDPatch_ShrinkUnrecordedDisk(t *testing.T) {
+    startExecutorFunc(t, func(action string, _ json.RawMessage) string {
+        if action == "get_vm_state" {
+            return `{"result":"executed","present":true,"state":"stopped","disk_gb":80}`
+        }
+        return ""
+    })
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    vmMu.Lock()
+    vmStore["vm-legacy-disk"] = vmEntry{ID: "vm-legacy-disk", Name: "legacy-disk", Status: "stopped"}
+    vmMu.Unlock()
+    defer func() {
+        vmMu.Lock()
+        delete(vmStore, "vm-legacy-disk")
+        vmMu.Unlock()
+    }()
+
+    resp := doJSON(t, http.MethodPatch, srv.URL+"/api/vms/vm-legacy-disk", `{"disk_size_gb":50}`)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadRequest {
+        t.Fatalf("expected 400 when shrinking below the host's 80 GB, got %d", resp.StatusCode)
+    }
+    resp = doJSON(t, http.MethodPatch, srv.URL+"/api/vms/vm-legacy-disk", `{"disk_size_gb":100}`)
+    var got vmEntry
+    _ = json.NewDecoder(resp.Body).Decode(&got)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK || got.DiskSizeGB != 100 {
+        t.Fatalf("expected growing to 100 GB to succeed, got %d %+v", resp.StatusCode, got)
+    }
+}
+
+// Verifies that a clone records the disk size it inherited and that tart set is refused while the VM runs.
+func TestHandleVMByIDPatch_RunningAndInheritedDisk(t *testing.T) {
+    state := "stopped"
+    present := false
+    startExecutorFunc(t, func(action string, _ json.RawMessage) string {
+        switch action {
+        case "get_vm_state":
+            if !present {
+                return `{"result":"executed","present":false}`
+            }
+            return `{"result":"executed","present":true,"state":"` + state + `","disk_gb":64}`
+        case "clone_vm":
+            present = true
+        }
+        return ""
+    })
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    resp := doJSON(t, http.MethodPost, srv.URL+"/api/vms", `{"name":"inherited-disk","image":"debian-13-arm64"}`)
+    var created vmEntry
+    _ = json.NewDecoder(resp.Body).Decode(&created)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusCreated {
+        t.Fatalf("expected 201 on create, got %d", resp.StatusCode)
+    }
+    resp = doJSON(t, http.MethodGet, srv.URL+"/api/vms/"+created.ID, "")
+    var got vmEntry
+    _ = json.NewDecoder(resp.Body).Decode(&got)
+    resp.Body.Close()
+    if got.DiskSizeGB != 64 {
+        t.Fatalf("expected the clone's 64 GB disk to be recorded, got %+v", got)
+    }
+
+    state = "running"
+    resp = doJSON(t, http.MethodPatch, srv.URL+"/api/vms/"+created.ID, `{"cpu":4}`)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusConflict {
+        t.Fatalf("expected 409 for a hardware change on a running VM, got %d", resp.StatusCode)
+    }
+
+    state = "stopped"
+    resp = doJSON(t, http.MethodPatch, srv.URL+"/api/vms/"+created.ID, `{"disk_size_gb":32}`)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadRequest {
+        t.Fatalf("expected 400 when shrinking below the inherited 64 GB, got %d", resp.StatusCode)
+    }
+    resp = doJSON(t, http.MethodPatch, srv.URL+"/api/vms/"+created.ID, `{"cpu":4}`)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("expected 200 for a hardware change on a stopped VM, got %d", resp.StatusCode)
+    }
+}
+
+func TestHandleVMByIDPatch_NotFound(t *testing.T) {
+    _ = startFakeExecutor(t)
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    req, _ := http.NewRequest(http.MethodPatch, srv.URL+"/api/vms/missing-vm", bytes.NewReader([]byte(`{"cpu":2}`)))
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusNotFound {
+        t.Fatalf("expected 404, got %d", resp.StatusCode)
+    }
+}
+
+func TestHandleVMByIDPowerRoutes(t *testing.T) {
+    _ = startFakeExecutor(t)
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    createBody, _ := json.Marshal(map[string]string{"name": "power-vm", "image": "debian-13-arm64"})
+    respCreate, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(createBody))
+    if err != nil {
+        t.Fatalf("create request failed: %v", err)
+    }
+    respCreate.Body.Close()
+
+    steps := []struct {
+        route      string
+        wantCode   int
+        wantStatus string
+    }{
+        {"suspend", http.StatusConflict, "stopped"},
+        {"run", http.StatusOK, "running"},
+        {"suspend", http.StatusOK, "suspended"},
+        {"stop", http.StatusOK, "stopped"},
+    }
+    for _, st := range steps {
+        resp, err := http.Post(srv.URL+"/api/vms/power-vm/"+st.route, "application/json", bytes.NewReader([]byte(`{"detach":true}`)))
+        if err != nil {
+            t.Fatalf("%s request failed: %v", st.route, err)
+        }
+        resp.Body.Close()
+        if resp.StatusCode != st.wantCode {
+            t.Fatalf("%s: expected %d, got %d", st.route, st.wantCode, resp.StatusCode)
+        }
+        resp, err = http.Get(srv.URL + "/api/vms/power-vm")
+        if err != nil {
+            t.Fatalf("get request failed: %v", err)
+        }
+        var got vmEntry
+        _ = json.NewDecoder(resp.Body).Decode(&got)
+        resp.Body.Close()
+        if got.Status != st.wantStatus {
+            t.Fatalf("after %s: expected status %q, got %q", st.route, st.wantStatus, got.Status)
+        }
+    }
+}
+
+// Verifies that GET reports the power state observed by the executor, so manual stops surface as drift.
+func TestHandleVMByIDGet_ObservedState(t *testing.T) {
+    startExecutorFunc(t, func(action string, _ json.RawMessage) string {
+        if action == "get_vm_state" {
+            return `{"result":"executed","state":"stopped"}`
+        }
+        return ""
+    })
+
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    createBody, _ := json.Marshal(map[string]string{"name": "drift-vm", "image": "debian-13-arm64"})
+    respCreate, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(createBody))
+    if err != nil {
+        t.Fatalf("create request failed: %v", err)
+    }
+    respCreate.Body.Close()
+    respRun, err := http.Post(srv.URL+"/api/vms/drift-vm/run", "application/json", bytes.NewReader([]byte(`{"detach":true}`)))
+    if err != nil {
+        t.Fatalf("run request failed: %v", err)
+    }
+    respRun.Body.Close()
+
+    resp, err := http.Get(srv.URL + "/api/vms/drift-vm")
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    defer resp.Body.Close()
+    var got vmEntry
+    _ = json.NewDecoder(resp.Body).Decode(&got)
+    if got.Status != "stopped" {
+        t.Fatalf("expected observed status stopped, got %q", got.Status)
+    }
+}
+
+func TestHandleImagesGet_FromExecutor(t *testing.T) {
+    startExecutorFunc(t, func(string, json.RawMessage) string {
+        return `{"result":"executed","images":[{"name":"sequoia-base","source":"local","disk_gb":50,"size_gb":22},{"name":"ghcr.io/cirruslabs/ubuntu:latest","source":"oci","disk_gb":20,"size_gb":4}]}`
+    })
+
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    resp, err := http.Get(srv.URL + "/api/images")
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    defer resp.Body.Close()
+    var images []imageEntry
+    if err := json.NewDecoder(resp.Body).Decode(&images); err != nil {
+        t.Fatalf("decode failed: %v", err)
+    }
+    if len(images) != 2 || images[0].ID != "sequoia-base" || images[1].Source != "oci" {
+        t.Fatalf("unexpected images: %+v", images)
+    }
+}
+
+func TestHandleImagesGet_ExecutorDown(t *testing.T) {
+    t.Setenv("EXECUTOR_URL", "http://127.0.0.1:1")
+
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    resp, err := http.Get(srv.URL + "/api/images")
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadGateway {
+        t.Fatalf("expected 502 when executor is unreachable, got %d", resp.StatusCode)
+    }
+}
+
+func TestHandleVMIP(t *testing.T) {
+    var gotWait int
+    startExecutorFunc(t, func(action string, data json.RawMessage) string {
+        if action == "get_ip" {
+            var req struct {
+                Wait int `json:"wait"`
+            }
+            _ = json.Unmarshal(data, &req)
+            gotWait = req.Wait
+            return `{"result":"executed","ip":"192.168.64.5","mac":"7a:65:e4:1b:2c:01"}`
+        }
+        return ""
+    })
+
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    createBody, _ := json.Marshal(map[string]string{"name": "ip-vm", "image": "debian-13-arm64"})
+    respCreate, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(createBody))
+    if err != nil {
+        t.Fatalf("create request failed: %v", err)
+    }
+    respCreate.Body.Close()
+
+    resp, err := http.Get(srv.URL + "/api/vms/ip-vm/ip?wait=30")
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    var got map[string]string
+    _ = json.NewDecoder(resp.Body).Decode(&got)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK || got["ip_address"] != "192.168.64.5" || got["mac_address"] == "" {
+        t.Fatalf("unexpected response %d: %v", resp.StatusCode, got)
+    }
+    if gotWait != 30 {
+        t.Fatalf("expected wait=30 forwarded to executor, got %v", gotWait)
+    }
+
+    // The address is remembered on the VM entry
+    resp, err = http.Get(srv.URL + "/api/vms/ip-vm")
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    var ent vmEntry
+    _ = json.NewDecoder(resp.Body).Decode(&ent)
+    resp.Body.Close()
+    if ent.IPAddress != "192.168.64.5" {
+        t.Fatalf("expected ip on VM entry, got %+v", ent)
+    }
+
+    resp, err = http.Get(srv.URL + "/api/vms/missing-vm/ip")
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusNotFound {
+        t.Fatalf("expected 404 for unknown VM, got %d", resp.StatusCode)
+    }
+}
+
+// Verifies that VMs get a stable generated ID and that renaming goes through tart rename.
+func TestHandleVMByIDPatch_Rename(t *testing.T) {
+    var actions []string
+    startExecutorFunc(t, func(action string, _ json.RawMessage) string {
+        actions = append(actions, action)
+        return ""
+    })
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    var ids []string
+    for _, name := range []string{"rename-a", "rename-b"} {
+        body, _ := json.Marshal(map[string]string{"name": name, "image": "debian-13-arm64"})
+        resp, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(body))
+        if err != nil {
+            t.Fatalf("create request failed: %v", err)
+        }
+        var created map[string]string
+        _ = json.NewDecoder(resp.Body).Decode(&created)
+        resp.Body.Close()
+        if created["id"] == "" || created["id"] == name {
+            t.Fatalf("expected a generated ID, got %q", created["id"])
+        }
+        ids = append(ids, created["id"])
+    }
+
+    patch := func(id, body string) int {
+        req, _ := http.NewRequest(http.MethodPatch, srv.URL+"/api/vms/"+id, bytes.NewReader([]byte(body)))
+        resp, err := http.DefaultClient.Do(req)
+        if err != nil {
+            t.Fatalf("patch request failed: %v", err)
+        }
+        resp.Body.Close()
+        return resp.StatusCode
+    }
+    if code := patch(ids[0], `{"name":"rename-b"}`); code != http.StatusConflict {
+        t.Fatalf("expected 409 when the new name is taken, got %d", code)
+    }
+    actions = nil
+    if code := patch(ids[0], `{"name":"rename-c"}`); code != http.StatusOK {
+        t.Fatalf("expected 200, got %d", code)
+    }
+    if len(actions) != 1 || actions[0] != "rename_vm" {
+        t.Fatalf("expected a rename_vm call, got %v", actions)
+    }
+
+    // The ID stays the same and the new name resolves to it
+    for _, key := range []string{ids[0], "rename-c"} {
+        resp, err := http.Get(srv.URL + "/api/vms/" + key)
+        if err != nil {
+            t.Fatalf("get request failed: %v", err)
+        }
+        var got vmEntry
+        _ = json.NewDecoder(resp.Body).Decode(&got)
+        resp.Body.Close()
+        if got.ID != ids[0] || got.Name != "rename-c" {
+            t.Fatalf("GET %s: unexpected entry %+v", key, got)
+        }
+    }
+
+    resp, err := http.Post(srv.URL+"/api/vms/"+ids[0]+"/run", "application/json", bytes.NewReader([]byte(`{"detach":true}`)))
+    if err != nil {
+        t.Fatalf("run request failed: %v", err)
+    }
+    resp.Body.Close()
+    if code := patch(ids[0], `{"name":"rename-d"}`); code != http.StatusConflict {
+        t.Fatalf("expected 409 when renaming a running VM, got %d", code)
+    }
+}
+
+// Verifies cloning from a managed VM: the source must be stopped and the relationship is recorded.
+func TestHandleVMsPost_SourceVM(t *testing.T) {
+    var cloneImage string
+    startExecutorFunc(t, func(action string, data json.RawMessage) string {
+        if action == "clone_vm" {
+            var req map[string]string
+            _ = json.Unmarshal(data, &req)
+            cloneImage = req["image"]
+        }
+        return ""
+    })
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    post := func(body map[string]string) (int, map[string]string) {
+        b, _ := json.Marshal(body)
+        resp, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(b))
+        if err != nil {
+            t.Fatalf("create request failed: %v", err)
+        }
+        defer resp.Body.Close()
+        var created map[string]string
+        _ = json.NewDecoder(resp.Body).Decode(&created)
+        return resp.StatusCode, created
+    }
+    _, golden := post(map[string]string{"name": "golden", "image": "debian-13-arm64"})
+
+    if code, _ := post(map[string]string{"name": "clone-1", "image": "debian-13-arm64", "source_vm": golden["id"]}); code != http.StatusBadRequest {
+        t.Fatalf("expected 400 with both image and source_vm, got %d", code)
+    }
+    if code, _ := post(map[string]string{"name": "clone-1", "source_vm": "no-such-vm"}); code != http.StatusBadRequest {
+        t.Fatalf("expected 400 for an unknown source, got %d", code)
+    }
+    resp, err := http.Post(srv.URL+"/api/vms/"+golden["id"]+"/run", "application/json", bytes.NewReader([]byte(`{"detach":true}`)))
+    if err != nil {
+        t.Fatalf("run request failed: %v", err)
+    }
+    resp.Body.Close()
+    if code, _ := post(map[string]string{"name": "clone-1", "source_vm": golden["id"]}); code != http.StatusConflict {
+        t.Fatalf("expected 409 for a running source, got %d", code)
+    }
+    resp, err = http.Post(srv.URL+"/api/vms/"+golden["id"]+"/stop", "application/json", nil)
+    if err != nil {
+        t.Fatalf("stop request failed: %v", err)
+    }
+    resp.Body.Close()
+
+    code, clone := post(map[string]string{"name": "clone-1", "source_vm": golden["id"]})
+    if code != http.StatusCreated {
+        t.Fatalf("expected 201, got %d", code)
+    }
+    if cloneImage != "golden" {
+        t.Fatalf("expected tart clone from the source VM name, got %q", cloneImage)
+    }
+    get := func(id string) vmEntry {
+        resp, err := http.Get(srv.URL + "/api/vms/" + id)
+        if err != nil {
+            t.Fatalf("get request failed: %v", err)
+        }
+        defer resp.Body.Close()
+        var ent vmEntry
+        _ = json.NewDecoder(resp.Body).Decode(&ent)
+        return ent
+    }
+    if got := get(clone["id"]); got.SourceVM != golden["id"] {
+        t.Fatalf("expected clone to record its source, got %+v", got)
+    }
+    if got := get(golden["id"]); len(got.Clones) != 1 || got.Clones[0] != clone["id"] {
+        t.Fatalf("expected source to list its clone, got %+v", got)
+    }
+}
+
+// Verifies that creating from a tag records the digest the pull resolved to.
+func TestHandleVMsPost_RecordsImageDigest(t *testing.T) {
+    startExecutorFunc(t, func(action string, _ json.RawMessage) string {
+        if action == "image_info" {
+            return `{"result":"executed","present":true,"digest":"sha256:abc","size_gb":20}`
+        }
+        return ""
+    })
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    body, _ := json.Marshal(map[string]string{"name": "digest-vm", "image": "ghcr.io/acme/ubuntu:latest"})
+    resp, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(body))
+    if err != nil {
+        t.Fatalf("create request failed: %v", err)
+    }
+    var created map[string]string
+    _ = json.NewDecoder(resp.Body).Decode(&created)
+    resp.Body.Close()
+
+    resp, err = http.Get(srv.URL + "/api/vms/" + created["id"])
+    if err != nil {
+        t.Fatalf("get request failed: %v", err)
+    }
+    var got vmEntry
+    _ = json.NewDecoder(resp.Body).Decode(&got)
+    resp.Body.Close()
+    if got.ImageDigest != "sha256:abc" {
+        t.Fatalf("expected image_digest sha256:abc, got %q", got.ImageDigest)
+    }
+}
+
+// Verifies that a name already taken on the host yields 409 unless adopt_existing is set,
+// and that unmanaged VMs are listed until they are adopted.
+func TestHandleVMsPost_AdoptExisting(t *testing.T) {
+    var cloned int
+    startExecutorFunc(t, func(action string, data json.RawMessage) string {
+        var req map[string]string
+        _ = json.Unmarshal(data, &req)
+        switch action {
+        case "get_vm_state":
+            if req["name"] == "legacy" {
+                return `{"result":"executed","present":true,"state":"running"}`
+            }
+            return `{"result":"executed","present":false}`
+        case "list_images":
+            return `{"result":"executed","images":[{"name":"legacy","source":"local","disk_gb":50,"state":"running"},{"name":"ghcr.io/acme/base:latest","source":"oci"}]}`
+        case "clone_vm":
+            cloned++
+        }
+        return ""
+    })
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    unmanaged := func() []vmEntry {
+        resp, err := http.Get(srv.URL + "/api/vms?unmanaged=true")
+        if err != nil {
+            t.Fatalf("list request failed: %v", err)
+        }
+        defer resp.Body.Close()
+        var list []vmEntry
+        _ = json.NewDecoder(resp.Body).Decode(&list)
+        return list
+    }
+    if list := unmanaged(); len(list) != 1 || list[0].Name != "legacy" || list[0].Status != "running" || list[0].DiskSizeGB != 50 {
+        t.Fatalf("expected legacy to be listed as unmanaged, got %+v", list)
+    }
+
+    resp := doJSON(t, http.MethodPost, srv.URL+"/api/vms", `{"name":"legacy","image":"debian-13-arm64"}`)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusConflict {
+        t.Fatalf("expected 409 for an existing unmanaged VM, got %d", resp.StatusCode)
+    }
+    for _, body := range []string{
+        `{"name":"legacy","adopt_existing":true,"user_data":"#cloud-config"}`,
+        `{"name":"legacy","adopt_existing":true,"ssh_authorized_keys":["ssh-ed25519 AAAA"]}`,
+    } {
+        resp = doJSON(t, http.MethodPost, srv.URL+"/api/vms", body)
+        resp.Body.Close()
+        if resp.StatusCode != http.StatusBadRequest {
+            t.Fatalf("expected 400 for first-boot settings on an adopted VM, got %d for %s", resp.StatusCode, body)
+        }
+    }
+    resp = doJSON(t, http.MethodPost, srv.URL+"/api/vms", `{"name":"legacy","adopt_existing":true}`)
+    var created map[string]string
+    _ = json.NewDecoder(resp.Body).Decode(&created)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusCreated || created["status"] != "running" {
+        t.Fatalf("expected adopted VM to be created as running, got %d %v", resp.StatusCode, created)
+    }
+    if cloned != 0 {
+        t.Fatalf("expected no clone_vm when adopting, got %d", cloned)
+    }
+    if list := unmanaged(); len(list) != 0 {
+        t.Fatalf("expected no unmanaged VMs after adoption, got %+v", list)
+    }
+    // Adopting does not make the caller the owner, so deleting still needs force
+    resp = doJSON(t, http.MethodDelete, srv.URL+"/api/vms/"+created["id"], "")
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusForbidden {
+        t.Fatalf("expected 403 deleting an adopted VM without force, got %d", resp.StatusCode)
+    }
+    resp = doJSON(t, http.MethodPost, srv.URL+"/api/vms", `{"name":"legacy","adopt_existing":true}`)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusConflict {
+        t.Fatalf("expected 409 for an already managed VM, got %d", resp.StatusCode)
+    }
+}
+
+// Verifies that deletes are refused for VMs created by another token or workspace,
+// and for VMs the controller does not manage, unless force=true is set.
+func TestHandleVMByIDDelete_Ownership(t *testing.T) {
+    _ = startFakeExecutor(t)
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    send := func(method, path, token, workspace, body string) (int, string) {
+        req, _ := http.NewRequest(method, srv.URL+path, bytes.NewReader([]byte(body)))
+        if token != "" {
+            req.Header.Set("Authorization", "Bearer "+token)
+        }
+        if workspace != "" {
+            req.Header.Set(workspaceHeader, workspace)
+        }
+        resp, err := http.DefaultClient.Do(req)
+        if err != nil {
+            t.Fatalf("%s %s failed: %v", method, path, err)
+        }
+        defer resp.Body.Close()
+        b, _ := io.ReadAll(resp.Body)
+        return resp.StatusCode, string(b)
+    }
+    code, body := send(http.MethodPost, "/api/vms", "alice-token", "prod", `{"name":"owned-vm","image":"debian-13-arm64"}`)
+    if code != http.StatusCreated {
+        t.Fatalf("expected 201 on create, got %d", code)
+    }
+    var created map[string]string
+    _ = json.Unmarshal([]byte(body), &created)
+    _, body = send(http.MethodGet, "/api/vms/"+created["id"], "alice-token", "", "")
+    var ent vmEntry
+    _ = json.Unmarshal([]byte(body), &ent)
+    if ent.Owner == nil || ent.Owner.Workspace != "prod" || strings.Contains(ent.Owner.Token, "alice-token") {
+        t.Fatalf("expected a fingerprinted owner in workspace prod, got %+v", ent.Owner)
+    }
+
+    cases := []struct {
+        path, token, workspace string
+        wantCode               int
+    }{
+        {"/api/vms/someone-elses-vm", "alice-token", "prod", http.StatusForbidden},
+        {"/api/vms/" + created["id"], "bob-token", "prod", http.StatusForbidden},
+        {"/api/vms/" + created["id"], "alice-token", "staging", http.StatusForbidden},
+        {"/api/vms/" + created["id"], "alice-token", "prod", http.StatusNoContent},
+        {"/api/vms/someone-elses-vm?force=true", "alice-token", "prod", http.StatusNoContent},
+    }
+    for _, c := range cases {
+        if code, body := send(http.MethodDelete, c.path, c.token, c.workspace, ""); code != c.wantCode {
+            t.Fatalf("DELETE %s as %s/%s: expected %d, got %d: %s", c.path, c.token, c.workspace, c.wantCode, code, body)
+        }
+    }
+}
+
+// Verifies that /exec forwards the command for a running VM and refuses stopped ones.
+func TestHandleVMExec(t *testing.T) {
+    state := "stopped"
+    var command []string
+    startExecutorFunc(t, func(action string, data json.RawMessage) string {
+        switch action {
+        case "get_vm_state":
+            return `{"result":"executed","present":true,"state":"` + state + `"}`
+        case "exec_vm":
+            var req struct {
+                Command []string `json:"command"`
+            }
+            _ = json.Unmarshal(data, &req)
+            command = req.Command
+            return `{"result":"executed","exit_code":1,"stdout":"out","stderr":"err"}`
+        }
+        return ""
+    })
+    srv := httptest.NewServer(SetupRouter())
+    defer srv.Close()
+
+    if resp := doJSON(t, http.MethodPost, srv.URL+"/api/vms/missing/exec", `{"command":["true"]}`); resp.StatusCode != http.StatusNotFound {
+        t.Fatalf("expected 404 for an unknown VM, got %d", resp.StatusCode)
+    }
+    vmMu.Lock()
+    vmStore["vm-exec"] = vmEntry{ID: "vm-exec", Name: "exec-vm", Status: "stopped"}
+    vmMu.Unlock()
+    defer func() {
+        vmMu.Lock()
+        delete(vmStore, "vm-exec")
+        vmMu.Unlock()
+    }()
+    if resp := doJSON(t, http.MethodPost, srv.URL+"/api/vms/vm-exec/exec", `{"command":[]}`); resp.StatusCode != http.StatusBadRequest {
+        t.Fatalf("expected 400 without a command, got %d", resp.StatusCode)
+    }
+    if resp := doJSON(t, http.MethodPost, srv.URL+"/api/vms/vm-exec/exec", `{"command":["true"]}`); resp.StatusCode != http.StatusConflict {
+        t.Fatalf("expected 409 for a stopped VM, got %d", resp.StatusCode)
+    }
+    state = "running"
+    resp := doJSON(t, http.MethodPost, srv.URL+"/api/vms/exec-vm/exec", `{"command":["hostname","-s"]}`)
+    defer resp.Body.Close()
+    var res map[string]interface{}
+    _ = json.NewDecoder(resp.Body).Decode(&res)
+    if resp.StatusCode != http.StatusOK || res["exit_code"] != float64(1) || res["stdout"] != "out" || res["stderr"] != "err" {
+        t.Fatalf("unexpected exec result %d %v", resp.StatusCode, res)
+    }
+    if len(command) != 2 || command[0] != "hostname" {
+        t.Fatalf("unexpected command forwarded: %v", command)
+    }
+}
@@ -0,0 +1,71 @@
+package tart
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// vmNetwork selects how a VM is attached to the network when it starts.
+// Mode is one of nat (Tart's default), softnet, bridged or host.
+type vmNetwork struct {
+	Mode          string   `json:"mode"`
+	Interface     string   `json:"interface,omitempty"`
+	SoftnetAllow  []string `json:"softnet_allow,omitempty"`
+	SoftnetExpose []string `json:"softnet_expose,omitempty"`
+}
+
+var networkModes = []string{"nat", "softnet", "bridged", "host"}
+
+// hostInterface is a host network interface that VMs can be bridged to.
+type hostInterface struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+func validateNetwork(n *vmNetwork) error {
+	if n == nil {
+		return nil
+	}
+	switch n.Mode {
+	case "nat", "softnet", "host":
+		if n.Interface != "" {
+			return fmt.Errorf("interface is only valid in bridged mode")
+		}
+	case "bridged":
+		if n.Interface == "" {
+			return fmt.Errorf("bridged mode requires an interface")
+		}
+	default:
+		return fmt.Errorf("unknown network mode %q, expected one of %s", n.Mode, strings.Join(networkModes, ", "))
+	}
+	if n.Mode != "softnet" && (len(n.SoftnetAllow) > 0 || len(n.SoftnetExpose) > 0) {
+		return fmt.Errorf("softnet_allow and softnet_expose require softnet mode")
+	}
+	for _, cidr := range n.SoftnetAllow {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid softnet_allow entry %q: %v", cidr, err)
+		}
+	}
+	for _, rule := range n.SoftnetExpose {
+		if err := validateExposeRule(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateExposeRule checks a softnet port forward of the form "host_port:guest_port".
+func validateExposeRule(rule string) error {
+	hostPort, guestPort, ok := strings.Cut(rule, ":")
+	if !ok || !validPort(hostPort) || !validPort(guestPort) {
+		return fmt.Errorf("invalid softnet_expose entry %q, expected host_port:guest_port", rule)
+	}
+	return nil
+}
+
+func validPort(s string) bool {
+	p, err := strconv.Atoi(s)
+	return err == nil && p > 0 && p <= 65535
+}
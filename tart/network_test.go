@@ -0,0 +1,168 @@
+package tart
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestValidateNetwork(t *testing.T) {
+	valid := []*vmNetwork{
+		nil,
+		{Mode: "nat"},
+		{Mode: "host"},
+		{Mode: "bridged", Interface: "en0"},
+		{Mode: "softnet", SoftnetAllow: []string{"10.0.0.0/8"}, SoftnetExpose: []string{"2222:22", "8080:80"}},
+	}
+	for _, n := range valid {
+		if err := validateNetwork(n); err != nil {
+			t.Errorf("%+v: unexpected error: %v", n, err)
+		}
+	}
+	invalid := []*vmNetwork{
+		{Mode: "vlan"},
+		{Mode: "bridged"},
+		{Mode: "nat", Interface: "en0"},
+		{Mode: "nat", SoftnetAllow: []string{"10.0.0.0/8"}},
+		{Mode: "softnet", SoftnetAllow: []string{"10.0.0.1"}},
+		{Mode: "softnet", SoftnetExpose: []string{"22"}},
+		{Mode: "softnet", SoftnetExpose: []string{"70000:22"}},
+	}
+	for _, n := range invalid {
+		if err := validateNetwork(n); err == nil {
+			t.Errorf("%+v: expected an error", n)
+		}
+	}
+}
+
+// The controller lists bridgeable interfaces and passes the network to tart run.
+func TestHandleVMs_Network(t *testing.T) {
+	var runData json.RawMessage
+	startExecutorFunc(t, func(action string, data json.RawMessage) string {
+		switch action {
+		case "list_interfaces":
+			return `{"result":"executed","interfaces":[{"name":"en0","display_name":"Ethernet"}]}`
+		case "run_vm":
+			runData = data
+		}
+		return ""
+	})
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/interfaces")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var ifaces []hostInterface
+	_ = json.NewDecoder(resp.Body).Decode(&ifaces)
+	resp.Body.Close()
+	if len(ifaces) != 1 || ifaces[0].Name != "en0" || ifaces[0].DisplayName != "Ethernet" {
+		t.Fatalf("unexpected interfaces %+v", ifaces)
+	}
+
+	post := func(n vmNetwork) int {
+		body, _ := json.Marshal(map[string]interface{}{"name": "lab-vm", "image": "base", "network": n})
+		resp, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post(vmNetwork{Mode: "bridged"}); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bridged mode without interface, got %d", code)
+	}
+	if code := post(vmNetwork{Mode: "bridged", Interface: "en0"}); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	resp, err = http.Post(srv.URL+"/api/vms/lab-vm/run", "application/json", bytes.NewReader([]byte(`{"detach":true}`)))
+	if err != nil {
+		t.Fatalf("run request failed: %v", err)
+	}
+	resp.Body.Close()
+	var got struct {
+		Network *vmNetwork `json:"network"`
+	}
+	_ = json.Unmarshal(runData, &got)
+	if got.Network == nil || got.Network.Mode != "bridged" || got.Network.Interface != "en0" {
+		t.Fatalf("expected bridged network in run_vm, got %s", runData)
+	}
+}
+
+// Planning a bridged VM fails early when the host has no such interface.
+func TestResourceVMNetworkDiff_UnknownInterface(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"name":"en0","display_name":"Ethernet"},{"name":"en1","display_name":"Wi-Fi"}]`))
+	}))
+	defer srv.Close()
+	conf := &config{ApiURL: srv.URL}
+
+	plan := func(iface string) error {
+		cfg := terraform.NewResourceConfigRaw(map[string]interface{}{
+			"name":    "lab-vm",
+			"image":   "base",
+			"network": []interface{}{map[string]interface{}{"mode": "bridged", "interface": iface}},
+		})
+		_, err := resourceVM().Diff(context.Background(), nil, cfg, conf)
+		return err
+	}
+	if err := plan("Wi-Fi"); err != nil {
+		t.Fatalf("unexpected error for a known interface: %v", err)
+	}
+	err := plan("en7")
+	if err == nil || !strings.Contains(err.Error(), "en0, en1") {
+		t.Fatalf("expected an error listing available interfaces, got %v", err)
+	}
+}
+
+// Removing the network block stores nat on the controller; reading it back
+// must not bring the block back, or every plan would restart the VM.
+func TestResourceVM_RemovedNetworkPlansClean(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"vm-1","name":"lab-vm","image":"base","status":"running","ip_address":"192.168.64.2","network":{"mode":"nat"}}`))
+	}))
+	defer srv.Close()
+	conf := &config{ApiURL: srv.URL}
+
+	raw := map[string]interface{}{"name": "lab-vm", "image": "base", "state": "running"}
+	d := schema.TestResourceDataRaw(t, resourceVM().Schema, raw)
+	d.SetId("vm-1")
+	if diags := resourceVMRead(context.Background(), d, conf); diags.HasError() {
+		t.Fatalf("read failed: %v", diags)
+	}
+	if n := d.Get("network").([]interface{}); len(n) != 0 {
+		t.Fatalf("expected no network block in state, got %v", n)
+	}
+
+	diff, err := resourceVM().Diff(context.Background(), d.State(), terraform.NewResourceConfigRaw(raw), conf)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	if diff != nil {
+		for k := range diff.Attributes {
+			if strings.HasPrefix(k, "network") {
+				t.Fatalf("expected an empty plan after removing the block, got a change to %s", k)
+			}
+		}
+	}
+
+	// A configured nat block is still read back as written
+	d = schema.TestResourceDataRaw(t, resourceVM().Schema, map[string]interface{}{
+		"name": "lab-vm", "image": "base", "network": []interface{}{map[string]interface{}{"mode": "nat"}},
+	})
+	d.SetId("vm-1")
+	if diags := resourceVMRead(context.Background(), d, conf); diags.HasError() {
+		t.Fatalf("read failed: %v", diags)
+	}
+	if n := d.Get("network").([]interface{}); len(n) != 1 {
+		t.Fatalf("expected the configured nat block to stay, got %v", n)
+	}
+}
@@ -0,0 +1,52 @@
+package tart
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// workspaceHeader carries the Terraform workspace label of the caller.
+const workspaceHeader = "X-Tart-Workspace"
+
+// vmOwner records who created a VM through the API. Token is a fingerprint of
+// the bearer token, never the token itself; anonymous callers share "anonymous".
+type vmOwner struct {
+	Token     string `json:"token"`
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// tokenFingerprint identifies a bearer token without keeping it around.
+func tokenFingerprint(token string) string {
+	if token == "" {
+		return "anonymous"
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// requestOwner derives the ownership metadata of an API request.
+func requestOwner(r *http.Request) vmOwner {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return vmOwner{
+		Token:     tokenFingerprint(token),
+		Workspace: r.Header.Get(workspaceHeader),
+	}
+}
+
+// checkOwnership explains why caller may not delete the VM, or returns nil.
+// Workspaces only have to match when both sides carry one.
+func checkOwnership(name string, owner *vmOwner, caller vmOwner) error {
+	if owner == nil {
+		return fmt.Errorf("VM %q has no ownership record (it was adopted or imported); pass force=true to delete it anyway", name)
+	}
+	if owner.Token != caller.Token {
+		return fmt.Errorf("VM %q was created with a different API token (%s); pass force=true to delete it anyway", name, owner.Token)
+	}
+	if owner.Workspace != "" && caller.Workspace != "" && owner.Workspace != caller.Workspace {
+		return fmt.Errorf("VM %q belongs to workspace %q, not %q; pass force=true to delete it anyway", name, owner.Workspace, caller.Workspace)
+	}
+	return nil
+}
@@ -1,39 +1,186 @@
 package tart
 
 import (
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 func Provider() *schema.Provider {
 	return &schema.Provider{
 		Schema: map[string]*schema.Schema{
+			"mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "api",
+				ValidateFunc: validation.StringInSlice([]string{"api", "local"}, false),
+				Description:  "api talks to the Tart API controller; local drives the tart CLI on this machine, for tart_vm and tart_vms only",
+			},
 			"api_url": {
 				Type:        schema.TypeString,
-				Required:    true,
-				Description: "Base URL of Tart API Controller",
+				Optional:    true,
+				Description: "Base URL of Tart API Controller; falls back to the profile, then TART_API_URL",
 			},
 			"api_token": {
 				Type:        schema.TypeString,
 				Optional:    true,
 				Sensitive:   true,
-				Description: "Bearer token for auth",
+				Description: "Bearer token for auth; falls back to the profile, then TART_API_TOKEN",
+			},
+			"workspace": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("TF_WORKSPACE", ""),
+				Description: "Workspace label recorded on VMs this provider creates, e.g. terraform.workspace; defaults to TF_WORKSPACE",
+			},
+			"registry_auth": registryAuthSchema("Credentials for private OCI registries, passed to tart pull with each request instead of a manual tart login on every host"),
+			"profile": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Named profile from ~/.config/tart/credentials (or TART_CREDENTIALS_FILE); defaults to TART_PROFILE",
+			},
+			"ca_cert_pem": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "PEM-encoded CA certificate(s) to trust in addition to the system pool",
+			},
+			"client_cert_pem": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				RequiredWith: []string{"client_key_pem"},
+				Description:  "PEM-encoded client certificate for mutual TLS",
+			},
+			"client_key_pem": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Sensitive:    true,
+				RequiredWith: []string{"client_cert_pem"},
+				Description:  "PEM-encoded private key for client_cert_pem",
+			},
+			"insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Skip TLS certificate verification (testing only)",
+			},
+			"request_timeout": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "0s",
+				ValidateFunc: validateDuration,
+				Description:  "Timeout for a single API request attempt; 0s leaves it to the resource timeouts",
+			},
+			"max_retries": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      0,
+				ValidateFunc: validation.IntBetween(0, 10),
+				Description:  "How often to retry idempotent API requests (GET, DELETE) after a network error, 5xx or 429 response",
+			},
+			"retry_backoff": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "1s",
+				ValidateFunc: validateDuration,
+				Description:  "Initial wait between retries; doubles after every attempt",
 			},
 		},
 		ResourcesMap: map[string]*schema.Resource{
-			"tart_vm": resourceVM(),
+			"tart_vm":            resourceVM(),
+			"tart_image":         resourceImage(),
+			"tart_disk":          resourceDisk(),
+			"tart_vm_exec":       resourceVMExec(),
+			"tart_vm_file":       resourceVMFile(),
+			"tart_registry_push": resourceRegistryPush(),
+		},
+		DataSourcesMap: map[string]*schema.Resource{
+			"tart_vms":    dataSourceVMs(),
+			"tart_images": dataSourceImages(),
 		},
 		ConfigureFunc: configureProvider,
 	}
 }
 
 type config struct {
-	ApiURL   string
-	ApiToken string
+	// Mode is "api" or "local"; Backend overrides the VM backend, as local mode does
+	Mode         string
+	Backend      vmBackend
+	ApiURL       string
+	ApiToken     string
+	Workspace    string
+	RegistryAuth []registryCredential
+	MaxRetries   int
+	RetryBackoff time.Duration
+	HTTPClient   *http.Client
+}
+
+func (c *config) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
 }
 
 func configureProvider(d *schema.ResourceData) (interface{}, error) {
+	if d.Get("mode").(string) == "local" {
+		// No controller to reach; only the registry credentials carry over to tart clone
+		return &config{
+			Mode:         "local",
+			Backend:      localBackend{},
+			RegistryAuth: expandRegistryAuth(d.Get("registry_auth").([]interface{})),
+		}, nil
+	}
+	backoff, err := time.ParseDuration(d.Get("retry_backoff").(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry_backoff: %w", err)
+	}
+	// Arguments in the provider block win over the profile and environment
+	prof, err := ResolveProfile(d.Get("profile").(string))
+	if err != nil {
+		return nil, err
+	}
+	if v := d.Get("api_url").(string); v != "" {
+		prof.URL = v
+	}
+	if v := d.Get("api_token").(string); v != "" {
+		prof.Token = v
+	}
+	if prof.URL == "" {
+		return nil, fmt.Errorf("api_url is required: set it in the provider block, a credentials profile or TART_API_URL")
+	}
+	timeout, err := time.ParseDuration(d.Get("request_timeout").(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid request_timeout: %w", err)
+	}
+	client, err := newHTTPClient(transportOptions{
+		CABundle:           prof.CABundle,
+		CACertPEM:          d.Get("ca_cert_pem").(string),
+		ClientCertPEM:      d.Get("client_cert_pem").(string),
+		ClientKeyPEM:       d.Get("client_key_pem").(string),
+		InsecureSkipVerify: d.Get("insecure_skip_verify").(bool),
+		RequestTimeout:     timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("configuring TLS: %w", err)
+	}
 	return &config{
-		ApiURL:   d.Get("api_url").(string),
-		ApiToken: d.Get("api_token").(string),
+		Mode:         "api",
+		ApiURL:       prof.URL,
+		ApiToken:     prof.Token,
+		Workspace:    d.Get("workspace").(string),
+		RegistryAuth: expandRegistryAuth(d.Get("registry_auth").([]interface{})),
+		MaxRetries:   d.Get("max_retries").(int),
+		RetryBackoff: backoff,
+		HTTPClient:   client,
 	}, nil
 }
+
+func validateDuration(v interface{}, k string) ([]string, []error) {
+	if _, err := time.ParseDuration(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%q must be a duration such as \"2s\" or \"1m\": %v", k, err)}
+	}
+	return nil, nil
+}
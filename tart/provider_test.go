@@ -0,0 +1,9 @@
+package tart
+
+import "testing"
+
+func TestProvider_InternalValidate(t *testing.T) {
+	if err := Provider().InternalValidate(); err != nil {
+		t.Fatalf("provider schema is invalid: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package tart
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// registryCredential authenticates `tart pull` against one registry host. It is
+// passed along with the request that needs it and never stored by the controller
+// or saved to the executor's keychain.
+type registryCredential struct {
+	Host     string `json:"host"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// registryAuthSchema is the registry_auth block shared by the provider and tart_vm.
+func registryAuthSchema(description string) *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		Description: description,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"host": {
+					Type:        schema.TypeString,
+					Required:    true,
+					Description: "Registry host, e.g. ghcr.io",
+				},
+				"username": {
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"password": {
+					Type:        schema.TypeString,
+					Required:    true,
+					Sensitive:   true,
+					Description: "Password or token with pull access",
+				},
+			},
+		},
+	}
+}
+
+func expandRegistryAuth(raw []interface{}) []registryCredential {
+	creds := make([]registryCredential, 0, len(raw))
+	for _, r := range raw {
+		m := r.(map[string]interface{})
+		creds = append(creds, registryCredential{
+			Host:     m["host"].(string),
+			Username: m["username"].(string),
+			Password: m["password"].(string),
+		})
+	}
+	return creds
+}
+
+// registryHost returns the registry host of an OCI reference such as ghcr.io/org/image:tag.
+func registryHost(ref string) string {
+	if i := strings.Index(ref, "/"); i > 0 {
+		return ref[:i]
+	}
+	return ""
+}
+
+// credentialFor picks the credential for ref's registry; earlier entries win,
+// so resource-level credentials are listed before the provider's.
+func credentialFor(creds []registryCredential, ref string) *registryCredential {
+	host := registryHost(ref)
+	for i := range creds {
+		if host != "" && strings.EqualFold(creds[i].Host, host) {
+			return &creds[i]
+		}
+	}
+	return nil
+}
+
+// pullImageData builds the executor's pull_image payload, adding credentials
+// only when they belong to ref's registry.
+func pullImageData(ref string, auth *registryCredential) (map[string]string, error) {
+	data := map[string]string{"ref": ref}
+	if err := checkRegistryAuth(ref, auth); err != nil {
+		return nil, err
+	}
+	if auth != nil {
+		data["username"] = auth.Username
+		data["password"] = auth.Password
+	}
+	return data, nil
+}
+
+// checkRegistryAuth rejects incomplete credentials and credentials for another registry than ref's.
+func checkRegistryAuth(ref string, auth *registryCredential) error {
+	if auth == nil {
+		return nil
+	}
+	if auth.Username == "" || auth.Password == "" {
+		return fmt.Errorf("registry_auth needs a username and password")
+	}
+	if !strings.EqualFold(auth.Host, registryHost(ref)) {
+		return fmt.Errorf("registry_auth is for %q, but %q is hosted on %q", auth.Host, ref, registryHost(ref))
+	}
+	return nil
+}
+
+// registryAuthHeader carries a registryCredential on requests without a body,
+// such as the remote digest lookup, as base64-encoded JSON.
+const registryAuthHeader = "X-Tart-Registry-Auth"
+
+func encodeRegistryAuth(auth *registryCredential) string {
+	b, _ := json.Marshal(auth)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// requestRegistryAuth decodes the registryAuthHeader of r; it returns nil when the header is absent.
+func requestRegistryAuth(r *http.Request) (*registryCredential, error) {
+	v := r.Header.Get(registryAuthHeader)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header: %v", registryAuthHeader, err)
+	}
+	var auth registryCredential
+	if err := json.Unmarshal(b, &auth); err != nil {
+		return nil, fmt.Errorf("invalid %s header: %v", registryAuthHeader, err)
+	}
+	return &auth, nil
+}
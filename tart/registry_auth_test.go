@@ -0,0 +1,66 @@
+package tart
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCredentialFor(t *testing.T) {
+	creds := []registryCredential{
+		{Host: "ghcr.io", Username: "resource"},
+		{Host: "GHCR.io", Username: "provider"},
+		{Host: "registry.example.com:5000", Username: "private"},
+	}
+	cases := map[string]string{
+		"ghcr.io/acme/ubuntu:latest":              "resource",
+		"registry.example.com:5000/team/macos:14": "private",
+		"docker.io/library/alpine":                "",
+		"debian-13-arm64":                         "",
+	}
+	for ref, want := range cases {
+		got := credentialFor(creds, ref)
+		if (got == nil && want != "") || (got != nil && got.Username != want) {
+			t.Errorf("%s: expected %q, got %+v", ref, want, got)
+		}
+	}
+}
+
+// Verifies that registry credentials reach pull_image and are not kept in the VM entry.
+func TestHandleVMsPost_RegistryAuth(t *testing.T) {
+	var pull map[string]string
+	startExecutorFunc(t, func(action string, data json.RawMessage) string {
+		if action == "pull_image" {
+			_ = json.Unmarshal(data, &pull)
+		}
+		return ""
+	})
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/vms", `{"name":"private-vm","image":"ghcr.io/acme/private:latest","registry_auth":{"host":"quay.io","username":"ci","password":"s3cret"}}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for credentials of another registry, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/vms", `{"name":"private-vm","image":"ghcr.io/acme/private:latest","registry_auth":{"host":"ghcr.io","username":"ci","password":"s3cret"}}`)
+	var created map[string]string
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	if pull["username"] != "ci" || pull["password"] != "s3cret" {
+		t.Fatalf("expected credentials in pull_image, got %v", pull)
+	}
+
+	vmMu.RLock()
+	ent := vmStore[created["id"]]
+	vmMu.RUnlock()
+	b, _ := json.Marshal(ent)
+	if strings.Contains(string(b), "s3cret") {
+		t.Fatalf("credentials must not be stored: %s", b)
+	}
+}
@@ -0,0 +1,119 @@
+package tart
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func resourceDisk() *schema.Resource {
+	return &schema.Resource{
+		Description:   "A raw data disk in the executor's disk directory that outlives the VMs it is attached to",
+		CreateContext: resourceDiskCreate,
+		ReadContext:   resourceDiskRead,
+		UpdateContext: resourceDiskUpdate,
+		DeleteContext: resourceDiskDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringMatch(regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`), "must be letters, digits, '.', '_' or '-'"),
+				Description:  "Disk name, unique per executor; attach it with attach_disk on tart_vm",
+			},
+			"size_gb": {
+				Type:         schema.TypeInt,
+				Required:     true,
+				ValidateFunc: validation.IntAtLeast(1),
+				Description:  "Disk size in GB; the image is sparse, growing is in place and shrinking forces replacement",
+			},
+			"label": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Format the disk as ext4 with this filesystem label; unset leaves it blank",
+				// Unset only means "do not format"; a filesystem the guest made later must not replace the disk
+				DiffSuppressFunc: func(_, _, new string, _ *schema.ResourceData) bool {
+					return new == ""
+				},
+			},
+			"path": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Location of the raw image on the executor host",
+			},
+		},
+		CustomizeDiff: customdiff.ForceNewIfChange("size_gb", func(_ context.Context, old, new, _ interface{}) bool {
+			return new.(int) < old.(int)
+		}),
+	}
+}
+
+func resourceDiskCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_disk"); diags != nil {
+		return diags
+	}
+	disk, err := createDisk(ctx, conf, diskCreateRequest{
+		Name:   d.Get("name").(string),
+		SizeGB: d.Get("size_gb").(int),
+		Label:  d.Get("label").(string),
+	})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(disk.Name)
+	return resourceDiskRead(ctx, d, m)
+}
+
+func resourceDiskRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_disk"); diags != nil {
+		return diags
+	}
+	disk, err := getDisk(ctx, conf, d.Id())
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return apiErrorDiag(err, "reading disk "+d.Id())
+	}
+	d.Set("name", disk.Name)
+	d.Set("size_gb", disk.SizeGB)
+	d.Set("label", disk.Label)
+	d.Set("path", disk.Path)
+	return nil
+}
+
+func resourceDiskUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_disk"); diags != nil {
+		return diags
+	}
+	if d.HasChange("size_gb") {
+		if err := resizeDisk(ctx, conf, d.Id(), d.Get("size_gb").(int)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	return resourceDiskRead(ctx, d, m)
+}
+
+func resourceDiskDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_disk"); diags != nil {
+		return diags
+	}
+	if err := deleteDisk(ctx, conf, d.Id()); err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,137 @@
+package tart
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceImage() *schema.Resource {
+	return &schema.Resource{
+		Description:   "An OCI image pulled into the executor's Tart cache, independent of any VM",
+		CreateContext: resourceImageCreate,
+		ReadContext:   resourceImageRead,
+		UpdateContext: resourceImageUpdate,
+		DeleteContext: resourceImageDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+			Update: schema.DefaultTimeout(60 * time.Minute),
+		},
+		Schema: map[string]*schema.Schema{
+			"ref": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "OCI reference to pull, e.g. ghcr.io/cirruslabs/macos-sequoia-base:latest",
+			},
+			"keep_locally": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Leave the image in the Tart cache on destroy instead of deleting it",
+			},
+			"digest": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Manifest digest of the cached image",
+			},
+			"size": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "Size of the cached image in GB",
+			},
+		},
+		CustomizeDiff: resourceImageCustomizeDiff,
+	}
+}
+
+// resourceImageCustomizeDiff plans a re-pull when the tag now points at a different remote digest.
+func resourceImageCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if d.Id() == "" || d.HasChange("ref") {
+		return nil
+	}
+	conf := m.(*config)
+	ref := d.Get("ref").(string)
+	remote := remoteImageDigest(ctx, conf, ref, credentialFor(conf.RegistryAuth, ref))
+	if remote != "" && remote != d.Get("digest").(string) {
+		if err := d.SetNewComputed("digest"); err != nil {
+			return err
+		}
+		return d.SetNewComputed("size")
+	}
+	return nil
+}
+
+// remoteImageDigest returns the digest ref currently resolves to in its registry, or ""
+// when the controller cannot tell. Registry lookups are best-effort; never block a plan on them.
+func remoteImageDigest(ctx context.Context, conf *config, ref string, auth *registryCredential) string {
+	img, err := getImage(ctx, conf, ref, true, auth)
+	if err != nil {
+		log.Printf("[WARN] could not resolve remote digest for %s: %v", ref, err)
+		return ""
+	}
+	return img.RemoteDigest
+}
+
+func resourceImageCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_image"); diags != nil {
+		return diags
+	}
+	img, err := pullImage(ctx, conf, d.Get("ref").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(img.ID)
+	return resourceImageRead(ctx, d, m)
+}
+
+func resourceImageRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_image"); diags != nil {
+		return diags
+	}
+	img, err := getImage(ctx, conf, d.Id(), false, nil)
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return apiErrorDiag(err, "reading image "+d.Id())
+	}
+	d.Set("ref", img.Ref)
+	d.Set("digest", img.Digest)
+	d.Set("size", img.SizeGB)
+	return nil
+}
+
+func resourceImageUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	// digest only changes when CustomizeDiff saw a new remote digest for the tag
+	if d.HasChange("digest") {
+		if _, err := pullImage(ctx, conf, d.Id()); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	return resourceImageRead(ctx, d, m)
+}
+
+func resourceImageDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_image"); diags != nil {
+		return diags
+	}
+	if !d.Get("keep_locally").(bool) {
+		if err := deleteImage(ctx, conf, d.Id()); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	d.SetId("")
+	return nil
+}
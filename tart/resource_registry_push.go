@@ -0,0 +1,106 @@
+package tart
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// pushPollInterval is how often a running push is checked on.
+var pushPollInterval = 10 * time.Second
+
+func resourceRegistryPush() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Publishes a stopped tart_vm to an OCI registry with tart push; it pushes again when triggers change",
+		CreateContext: resourceRegistryPushCreate,
+		ReadContext:   resourceRegistryPushRead,
+		DeleteContext: resourceRegistryPushDelete,
+		// Uploading a macOS disk can take a long time on a slow uplink
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+		},
+		Schema: map[string]*schema.Schema{
+			"vm_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "ID of the tart_vm to push; it must be stopped",
+			},
+			"ref": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "Target reference, e.g. ghcr.io/acme/macos-xcode:15.4",
+			},
+			"tags": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Extra tags to publish in the same repository, e.g. [\"latest\"]",
+			},
+			"triggers": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Arbitrary values that push again when they change",
+			},
+			"digest": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Manifest digest of the pushed image",
+			},
+		},
+	}
+}
+
+func resourceRegistryPushCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_registry_push"); diags != nil {
+		return diags
+	}
+	vmID := d.Get("vm_id").(string)
+	ref := d.Get("ref").(string)
+	var tags []string
+	for _, t := range d.Get("tags").([]interface{}) {
+		tags = append(tags, t.(string))
+	}
+	job, err := startPush(ctx, conf, vmID, vmPushRequest{
+		Ref:          ref,
+		Tags:         tags,
+		RegistryAuth: credentialFor(conf.RegistryAuth, ref),
+	})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	for job.Status == "running" {
+		select {
+		case <-ctx.Done():
+			return diag.Errorf("waiting for push %s of VM %s: %v", job.ID, vmID, ctx.Err())
+		case <-time.After(pushPollInterval):
+		}
+		if job, err = getPush(ctx, conf, job.ID); err != nil {
+			return diag.Errorf("checking push of VM %s: %v", vmID, err)
+		}
+	}
+	if job.Status != "succeeded" {
+		return diag.Errorf("pushing VM %s to %s failed: %s", vmID, ref, job.Error)
+	}
+	d.SetId(job.ID)
+	d.Set("digest", job.Digest)
+	return nil
+}
+
+// resourceRegistryPushRead keeps the recorded push; what happens to the tag in the registry afterwards is not tracked.
+func resourceRegistryPushRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return nil
+}
+
+// resourceRegistryPushDelete only forgets the push; published images stay in the registry.
+func resourceRegistryPushDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	d.SetId("")
+	return nil
+}
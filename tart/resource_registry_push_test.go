@@ -0,0 +1,172 @@
+package tart
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestPushRefs(t *testing.T) {
+	refs, err := pushRefs("ghcr.io/acme/golden:15.4", []string{"latest", "stable"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"ghcr.io/acme/golden:15.4", "ghcr.io/acme/golden:latest", "ghcr.io/acme/golden:stable"}
+	for i := range want {
+		if refs[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, refs)
+		}
+	}
+	if refs, _ := pushRefs("localhost:5000/golden", []string{"v1"}); len(refs) != 2 || refs[1] != "localhost:5000/golden:v1" {
+		t.Fatalf("unexpected refs for a registry with a port: %v", refs)
+	}
+	for _, bad := range []string{"golden", "ghcr.io/acme/golden@sha256:abc", "https://ghcr.io/acme/golden"} {
+		if _, err := pushRefs(bad, nil); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	if _, err := pushRefs("ghcr.io/acme/golden:1", []string{"a/b"}); err == nil {
+		t.Errorf("expected an invalid tag to be rejected")
+	}
+}
+
+// Drives the resource against the real controller routes with a fake executor.
+func TestResourceRegistryPushCreate(t *testing.T) {
+	state := "running"
+	var pushed map[string]interface{}
+	startExecutorFunc(t, func(action string, data json.RawMessage) string {
+		switch action {
+		case "get_vm_state":
+			return `{"result":"executed","present":true,"state":"` + state + `"}`
+		case "push_vm":
+			time.Sleep(20 * time.Millisecond)
+			_ = json.Unmarshal(data, &pushed)
+			return `{"result":"executed","digest":"sha256:feed"}`
+		}
+		return ""
+	})
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+	defer func(old time.Duration) { pushPollInterval = old }(pushPollInterval)
+	pushPollInterval = 5 * time.Millisecond
+
+	vmMu.Lock()
+	vmStore["vm-golden"] = vmEntry{ID: "vm-golden", Name: "golden", Status: "stopped"}
+	vmMu.Unlock()
+	defer func() {
+		vmMu.Lock()
+		delete(vmStore, "vm-golden")
+		vmMu.Unlock()
+	}()
+	conf := &config{
+		ApiURL:       srv.URL + "/api",
+		RegistryAuth: []registryCredential{{Host: "ghcr.io", Username: "ci", Password: "s3cret"}},
+	}
+	raw := map[string]interface{}{
+		"vm_id": "vm-golden",
+		"ref":   "ghcr.io/acme/golden:15.4",
+		"tags":  []interface{}{"latest"},
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceRegistryPush().Schema, raw)
+	if diags := resourceRegistryPushCreate(context.Background(), d, conf); !diags.HasError() {
+		t.Fatalf("expected pushing a running VM to fail")
+	}
+
+	state = "stopped"
+	d = schema.TestResourceDataRaw(t, resourceRegistryPush().Schema, raw)
+	if diags := resourceRegistryPushCreate(context.Background(), d, conf); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if d.Get("digest").(string) != "sha256:feed" || d.Id() == "" {
+		t.Fatalf("unexpected state id=%q digest=%q", d.Id(), d.Get("digest"))
+	}
+	refs, _ := pushed["refs"].([]interface{})
+	if pushed["name"] != "golden" || len(refs) != 2 || refs[1] != "ghcr.io/acme/golden:latest" || pushed["username"] != "ci" {
+		t.Fatalf("unexpected push_vm data %v", pushed)
+	}
+}
+
+// A VM cannot be started while it is pushed, and finished jobs are dropped after pushJobTTL.
+func TestHandleVMPush_BlocksChangesAndPrunesJobs(t *testing.T) {
+	release := make(chan struct{})
+	startExecutorFunc(t, func(action string, data json.RawMessage) string {
+		switch action {
+		case "get_vm_state":
+			return `{"result":"executed","present":true,"state":"stopped"}`
+		case "push_vm":
+			<-release
+			return `{"result":"executed","digest":"sha256:feed"}`
+		}
+		return ""
+	})
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+	finishPush := sync.OnceFunc(func() { close(release) })
+	defer finishPush()
+
+	vmMu.Lock()
+	vmStore["vm-pushing"] = vmEntry{ID: "vm-pushing", Name: "pushing", Status: "stopped"}
+	vmMu.Unlock()
+	old := time.Now().UTC().Add(-2 * pushJobTTL)
+	pushMu.Lock()
+	pushJobs["push-stale"] = pushJob{ID: "push-stale", VMID: "vm-other", Status: "succeeded", StartedAt: old, FinishedAt: &old}
+	pushMu.Unlock()
+	t.Cleanup(func() {
+		vmMu.Lock()
+		delete(vmStore, "vm-pushing")
+		vmMu.Unlock()
+	})
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/vms/vm-pushing/push", `{"ref":"ghcr.io/acme/pushing:1"}`)
+	var job pushJob
+	_ = json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+	pushMu.RLock()
+	_, stale := pushJobs["push-stale"]
+	pushMu.RUnlock()
+	if stale {
+		t.Fatalf("expected the finished job to be pruned")
+	}
+
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodPost, "/api/vms/vm-pushing/run", `{"detach":true}`},
+		{http.MethodPatch, "/api/vms/vm-pushing", `{"name":"renamed"}`},
+		{http.MethodPatch, "/api/vms/vm-pushing", `{"cpu":4}`},
+		{http.MethodDelete, "/api/vms/vm-pushing?force=true", ""},
+	} {
+		resp = doJSON(t, tc.method, srv.URL+tc.path, tc.body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusConflict {
+			t.Fatalf("%s %s %s: expected 409 while the VM is being pushed, got %d", tc.method, tc.path, tc.body, resp.StatusCode)
+		}
+	}
+
+	finishPush()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		pushMu.RLock()
+		status := pushJobs[job.ID].Status
+		pushMu.RUnlock()
+		if status != "running" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("push job did not finish")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/vms/vm-pushing/run", `{"detach":true}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the VM to start once the push finished, got %d", resp.StatusCode)
+	}
+}
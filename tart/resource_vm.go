@@ -1,58 +1,653 @@
 package tart
 
 import (
-    //"context"
-    //"fmt"
+    "context"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+    "github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
     "github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+    "github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 func resourceVM() *schema.Resource {
     return &schema.Resource{
-        Create: resourceVMCreate,
-        Read:   resourceVMRead,
-        Delete: resourceVMDelete,
+        CreateContext: resourceVMCreate,
+        ReadContext:   resourceVMRead,
+        UpdateContext: resourceVMUpdate,
+        DeleteContext: resourceVMDelete,
         Importer: &schema.ResourceImporter{
-            StateContext: schema.ImportStatePassthroughContext,
+            StateContext: resourceVMImport,
+        },
+        // Creating may pull a multi-GB image, so it gets the most generous default
+        Timeouts: &schema.ResourceTimeout{
+            Create: schema.DefaultTimeout(30 * time.Minute),
+            Read:   schema.DefaultTimeout(5 * time.Minute),
+            Update: schema.DefaultTimeout(10 * time.Minute),
+            Delete: schema.DefaultTimeout(10 * time.Minute),
         },
         Schema: map[string]*schema.Schema{
-            "name":  {Type: schema.TypeString, Required: true, ForceNew: true},
-            "image": {Type: schema.TypeString, Required: true, ForceNew: true},
+            "name": {
+                Type:        schema.TypeString,
+                Required:    true,
+                Description: "VM name on the host; changing it renames the VM in place (tart rename)",
+            },
+            "image": {
+                Type:         schema.TypeString,
+                Optional:     true,
+                ForceNew:     true,
+                ExactlyOneOf: []string{"image", "source_vm"},
+                // Adopted and imported VMs have no recorded image; don't replace them over it
+                DiffSuppressFunc: func(_, old, _ string, d *schema.ResourceData) bool {
+                    return old == "" && d.Id() != ""
+                },
+                Description: "Image to clone: OCI reference, local Tart VM/image name or a disk image URL",
+            },
+            "image_digest": {
+                Type:        schema.TypeString,
+                Computed:    true,
+                Description: "Manifest digest the image reference resolved to when the VM was created",
+            },
+            "replace_on_image_update": {
+                Type:        schema.TypeBool,
+                Optional:    true,
+                Default:     false,
+                Description: "Plan a replacement when the image tag now points to a different digest than image_digest",
+            },
+            "adopt_existing": {
+                Type:        schema.TypeBool,
+                Optional:    true,
+                Default:     false,
+                Description: "Take over a VM of the same name that already exists on the host instead of failing with a conflict",
+            },
+            "registry_auth": registryAuthSchema("Registry credentials for pulling image; they take precedence over the provider's registry_auth"),
+            "force_delete": {
+                Type:        schema.TypeBool,
+                Optional:    true,
+                Default:     false,
+                Description: "Delete the VM even if it was created by another API token or workspace, or adopted or imported",
+            },
+            "source_vm": {
+                Type:        schema.TypeString,
+                Optional:    true,
+                ForceNew:    true,
+                Description: "ID of a stopped tart_vm to clone (copy-on-write on APFS) instead of an image",
+            },
             "status": {Type: schema.TypeString, Computed: true},
+            "state": {
+                Type:         schema.TypeString,
+                Optional:     true,
+                Computed:     true,
+                ValidateFunc: validation.StringInSlice([]string{"running", "stopped", "suspended"}, false),
+                Description:  "Desired power state: running, stopped or suspended",
+            },
+            "cpu": {
+                Type:         schema.TypeInt,
+                Optional:     true,
+                Computed:     true,
+                ValidateFunc: validation.IntAtLeast(1),
+                Description:  "Number of virtual CPUs (tart set --cpu)",
+            },
+            "memory_mb": {
+                Type:         schema.TypeInt,
+                Optional:     true,
+                Computed:     true,
+                ValidateFunc: validation.IntAtLeast(512),
+                Description:  "Memory size in MB (tart set --memory)",
+            },
+            "disk_size_gb": {
+                Type:         schema.TypeInt,
+                Optional:     true,
+                Computed:     true,
+                ValidateFunc: validation.IntAtLeast(1),
+                Description:  "Disk size in GB (tart set --disk-size); shrinking forces replacement",
+            },
+            "user_data": {
+                Type:        schema.TypeString,
+                Optional:    true,
+                ForceNew:    true,
+                Description: "cloud-init user-data, delivered on first boot through a NoCloud cidata seed disk",
+            },
+            "meta_data": {
+                Type:        schema.TypeString,
+                Optional:    true,
+                ForceNew:    true,
+                Description: "cloud-init meta-data; defaults to instance-id and local-hostname set to the VM name",
+            },
+            "network_config": {
+                Type:        schema.TypeString,
+                Optional:    true,
+                ForceNew:    true,
+                Description: "cloud-init network-config (version 1 or 2)",
+            },
+            "ssh_authorized_keys": {
+                Type:        schema.TypeList,
+                Optional:    true,
+                ForceNew:    true,
+                Elem:        &schema.Schema{Type: schema.TypeString},
+                Description: "SSH public keys installed for the guest's default user (cloud-init on Linux, guest agent on macOS)",
+            },
+            "generate_ssh_key": {
+                Type:        schema.TypeBool,
+                Optional:    true,
+                ForceNew:    true,
+                Default:     false,
+                Description: "Generate an ed25519 keypair, install its public key and expose the private key as ssh_private_key",
+            },
+            "ssh_public_key": {
+                Type:        schema.TypeString,
+                Computed:    true,
+                Description: "Public half of the generated keypair, in authorized_keys format",
+            },
+            "ssh_private_key": {
+                Type:        schema.TypeString,
+                Computed:    true,
+                Sensitive:   true,
+                Description: "Private half of the generated keypair, in OpenSSH PEM format",
+            },
+            "shared_directory": {
+                Type:        schema.TypeList,
+                Optional:    true,
+                Description: "Host directory shared with the guest (tart run --dir); changes restart a running VM",
+                Elem: &schema.Resource{
+                    Schema: map[string]*schema.Schema{
+                        "name": {
+                            Type:        schema.TypeString,
+                            Required:    true,
+                            Description: "Share name, shown to macOS guests under /Volumes/My Shared Files",
+                        },
+                        "host_path": {
+                            Type:        schema.TypeString,
+                            Required:    true,
+                            Description: "Absolute host path; must be inside the controller's TART_SHARED_DIR_ALLOWLIST",
+                        },
+                        "read_only": {
+                            Type:     schema.TypeBool,
+                            Optional: true,
+                            Default:  false,
+                        },
+                        "tag": {
+                            Type:        schema.TypeString,
+                            Optional:    true,
+                            Description: "virtiofs mount tag, for mounting the share in Linux guests",
+                        },
+                    },
+                },
+            },
+            "attach_disk": {
+                Type:        schema.TypeList,
+                Optional:    true,
+                Description: "tart_disk passed to tart run --disk; changes restart a running VM",
+                Elem: &schema.Resource{
+                    Schema: map[string]*schema.Schema{
+                        "disk": {
+                            Type:        schema.TypeString,
+                            Required:    true,
+                            Description: "Name of the tart_disk to attach",
+                        },
+                        "read_only": {
+                            Type:     schema.TypeBool,
+                            Optional: true,
+                            Default:  false,
+                        },
+                    },
+                },
+            },
+            "network": {
+                Type:        schema.TypeList,
+                Optional:    true,
+                MaxItems:    1,
+                Description: "Network attachment used by tart run; changes restart a running VM",
+                Elem: &schema.Resource{
+                    Schema: map[string]*schema.Schema{
+                        "mode": {
+                            Type:         schema.TypeString,
+                            Optional:     true,
+                            Default:      "nat",
+                            ValidateFunc: validation.StringInSlice(networkModes, false),
+                            Description:  "nat (default), softnet, bridged or host",
+                        },
+                        "interface": {
+                            Type:        schema.TypeString,
+                            Optional:    true,
+                            Description: "Host interface for bridged mode, e.g. en0; see GET /api/interfaces",
+                        },
+                        "softnet_allow": {
+                            Type:        schema.TypeList,
+                            Optional:    true,
+                            Elem:        &schema.Schema{Type: schema.TypeString, ValidateFunc: validation.IsCIDR},
+                            Description: "CIDRs the VM may reach in softnet mode (--net-softnet-allow)",
+                        },
+                        "softnet_expose": {
+                            Type:     schema.TypeList,
+                            Optional: true,
+                            Elem: &schema.Schema{
+                                Type: schema.TypeString,
+                                ValidateFunc: func(v interface{}, k string) ([]string, []error) {
+                                    if err := validateExposeRule(v.(string)); err != nil {
+                                        return nil, []error{err}
+                                    }
+                                    return nil, nil
+                                },
+                            },
+                            Description: "host_port:guest_port forwards in softnet mode (--net-softnet-expose)",
+                        },
+                    },
+                },
+            },
+            "wait_for_ip": {
+                Type:        schema.TypeBool,
+                Optional:    true,
+                Default:     false,
+                Description: "Wait for the running VM to obtain an IP address before finishing create or start",
+            },
+            "wait_for_ip_timeout": {
+                Type:         schema.TypeString,
+                Optional:     true,
+                Default:      "5m",
+                ValidateFunc: validateDuration,
+                Description:  "How long to wait for an IP address when wait_for_ip is set",
+            },
+            "ip_address": {
+                Type:        schema.TypeString,
+                Computed:    true,
+                Description: "IPv4 address of the running VM (tart ip)",
+            },
+            "mac_address": {
+                Type:        schema.TypeString,
+                Computed:    true,
+                Description: "MAC address of the VM's network interface",
+            },
         },
+        CustomizeDiff: customdiff.All(
+            // Tart can only grow a disk, so a smaller disk_size_gb means a new VM.
+            customdiff.ForceNewIfChange("disk_size_gb", func(_ context.Context, old, new, _ interface{}) bool {
+                return new.(int) < old.(int)
+            }),
+            resourceVMNetworkDiff,
+            resourceVMImageDiff,
+            resourceVMLocalDiff,
+        ),
     }
 }
 
-func resourceVMCreate(d *schema.ResourceData, m interface{}) error {
+func resourceVMCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	conf := m.(*config)
-	id, status, err := createVM(conf, d.Get("name").(string), d.Get("image").(string))
+	name := d.Get("name").(string)
+	var keys []string
+	for _, k := range d.Get("ssh_authorized_keys").([]interface{}) {
+		keys = append(keys, k.(string))
+	}
+	var publicKey, privateKey string
+	if d.Get("generate_ssh_key").(bool) {
+		var err error
+		publicKey, privateKey, err = generateSSHKeyPair("terraform@" + name)
+		if err != nil {
+			return diag.Errorf("generating SSH key: %s", err)
+		}
+		keys = append(keys, publicKey)
+	}
+	image := d.Get("image").(string)
+	id, status, err := conf.vms().CreateVM(ctx, vmCreateRequest{
+		Name:              name,
+		Image:             image,
+		SourceVM:          d.Get("source_vm").(string),
+		CPU:               d.Get("cpu").(int),
+		MemoryMB:          d.Get("memory_mb").(int),
+		DiskSizeGB:        d.Get("disk_size_gb").(int),
+		UserData:          d.Get("user_data").(string),
+		MetaData:          d.Get("meta_data").(string),
+		NetworkConfig:     d.Get("network_config").(string),
+		SSHAuthorizedKeys: keys,
+		SharedDirectories: expandSharedDirs(d.Get("shared_directory").([]interface{})),
+		Network:           expandNetwork(d.Get("network").([]interface{})),
+		Disks:             expandAttachedDisks(d.Get("attach_disk").([]interface{})),
+		AdoptExisting:     d.Get("adopt_existing").(bool),
+		RegistryAuth:      credentialFor(append(expandRegistryAuth(d.Get("registry_auth").([]interface{})), conf.RegistryAuth...), image),
+	})
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	d.SetId(id)
+	d.Set("ssh_public_key", publicKey)
+	d.Set("ssh_private_key", privateKey)
 	d.Set("status", status)
-	return resourceVMRead(d, m)
+	// A fresh clone is stopped; only act when another state is requested
+	if state, ok := d.GetOk("state"); ok && state.(string) != "stopped" {
+		if err := conf.vms().SetVMState(ctx, id, state.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+		if state.(string) == "running" {
+			if diags := waitForVMIP(ctx, d, conf); diags.HasError() {
+				return diags
+			}
+		}
+	}
+	return resourceVMRead(ctx, d, m)
 }
 
-func resourceVMRead(d *schema.ResourceData, m interface{}) error {
+// resourceVMImport accepts a controller ID or a VM name. A VM that exists on the
+// host but is unknown to the controller (see GET /vms?unmanaged=true) is adopted first.
+func resourceVMImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
 	conf := m.(*config)
-	id := d.Id()
-	name, image, status, err := getVM(conf, id)
+	vm, err := conf.vms().GetVM(ctx, d.Id())
+	if err == nil {
+		if vm.ID != "" {
+			d.SetId(vm.ID)
+		}
+		return []*schema.ResourceData{d}, nil
+	}
+	if !isNotFound(err) {
+		return nil, err
+	}
+	id, _, err := conf.vms().CreateVM(ctx, vmCreateRequest{Name: d.Id(), AdoptExisting: true})
 	if err != nil {
+		return nil, fmt.Errorf("adopting VM %q: %w", d.Id(), err)
+	}
+	d.SetId(id)
+	d.Set("adopt_existing", true)
+	return []*schema.ResourceData{d}, nil
+}
+
+func resourceVMRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	id := d.Id()
+	vm, err := conf.vms().GetVM(ctx, id)
+	if isNotFound(err) {
 		d.SetId("")
 		return nil
 	}
-	d.Set("name", name)
-	d.Set("image", image)
-	d.Set("status", status)
+	if err != nil {
+		return apiErrorDiag(err, "reading VM "+id)
+	}
+	if vm.ID != "" && vm.ID != id {
+		// Imported by name, or state from before VMs had their own IDs
+		d.SetId(vm.ID)
+	}
+	d.Set("name", vm.Name)
+	d.Set("image", vm.Image)
+	d.Set("image_digest", vm.ImageDigest)
+	if _, ok := d.GetOk("source_vm"); !ok {
+		// Keep a configured name reference as is; the controller reports IDs
+		d.Set("source_vm", vm.SourceVM)
+	}
+	d.Set("status", vm.Status)
+	d.Set("state", vm.Status)
+	if vm.CPU > 0 {
+		d.Set("cpu", vm.CPU)
+	}
+	if vm.MemoryMB > 0 {
+		d.Set("memory_mb", vm.MemoryMB)
+	}
+	if vm.DiskSizeGB > 0 {
+		d.Set("disk_size_gb", vm.DiskSizeGB)
+	}
+	d.Set("shared_directory", flattenSharedDirs(vm.SharedDirectories))
+	network := flattenNetwork(vm.Network)
+	if isDefaultNetwork(vm.Network) && len(d.Get("network").([]interface{})) == 0 {
+		// Removing the block stores Tart's default nat; keep it out of state so the plan stays empty
+		network = nil
+	}
+	d.Set("network", network)
+	d.Set("attach_disk", flattenAttachedDisks(vm.Disks))
+	ip, mac := vm.IPAddress, vm.MACAddress
+	if vm.Status == "running" && ip == "" {
+		// Best-effort: the guest may not have a lease yet
+		if res, err := conf.vms().GetVMIP(ctx, id, 0); err == nil {
+			ip, mac = res.IPAddress, res.MACAddress
+		}
+	}
+	d.Set("ip_address", ip)
+	if mac != "" {
+		d.Set("mac_address", mac)
+	}
+	return nil
+}
+
+// waitForVMIP blocks until the VM reports an IP address when wait_for_ip is set.
+func waitForVMIP(ctx context.Context, d *schema.ResourceData, conf *config) diag.Diagnostics {
+	if !d.Get("wait_for_ip").(bool) {
+		return nil
+	}
+	timeout, err := time.ParseDuration(d.Get("wait_for_ip_timeout").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	res, err := conf.vms().GetVMIP(ctx, d.Id(), timeout)
+	if err != nil {
+		return diag.Errorf("waiting for IP address of VM %s: %v", d.Id(), err)
+	}
+	if res.IPAddress == "" {
+		return diag.Errorf("VM %s did not report an IP address within %s", d.Id(), timeout)
+	}
+	d.Set("ip_address", res.IPAddress)
+	d.Set("mac_address", res.MACAddress)
 	return nil
 }
 
-func resourceVMDelete(d *schema.ResourceData, m interface{}) error {
+func resourceVMUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	state := d.Get("state").(string)
+	// Hardware, shares, networking and disks are only picked up by tart run, and tart set
+	// and tart rename need a stopped VM, so a running VM is stopped first and started again at the end
+	restart := d.HasChanges("name", "cpu", "memory_mb", "disk_size_gb", "shared_directory", "network", "attach_disk") && !d.HasChange("state") && state == "running"
+	if restart {
+		if err := conf.vms().SetVMState(ctx, d.Id(), "stopped"); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	// Stop or suspend before resizing and start afterwards, so tart set sees a quiet VM
+	if d.HasChange("state") && state != "running" {
+		if err := conf.vms().SetVMState(ctx, d.Id(), state); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	if d.HasChanges("name", "cpu", "memory_mb", "disk_size_gb", "shared_directory", "network", "attach_disk") {
+		var in vmUpdateRequest
+		if d.HasChange("name") {
+			in.Name = d.Get("name").(string)
+		}
+		if d.HasChange("cpu") {
+			in.CPU = d.Get("cpu").(int)
+		}
+		if d.HasChange("memory_mb") {
+			in.MemoryMB = d.Get("memory_mb").(int)
+		}
+		if d.HasChange("disk_size_gb") {
+			in.DiskSizeGB = d.Get("disk_size_gb").(int)
+		}
+		if d.HasChange("shared_directory") {
+			dirs := expandSharedDirs(d.Get("shared_directory").([]interface{}))
+			in.SharedDirectories = &dirs
+		}
+		if d.HasChange("network") {
+			in.Network = expandNetwork(d.Get("network").([]interface{}))
+			if in.Network == nil {
+				// Removing the block goes back to Tart's default
+				in.Network = &vmNetwork{Mode: "nat"}
+			}
+		}
+		if d.HasChange("attach_disk") {
+			disks := expandAttachedDisks(d.Get("attach_disk").([]interface{}))
+			in.Disks = &disks
+		}
+		id, err := conf.vms().UpdateVM(ctx, d.Id(), in)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		d.SetId(id)
+	}
+	if (d.HasChange("state") && state == "running") || restart {
+		if err := conf.vms().SetVMState(ctx, d.Id(), state); err != nil {
+			return diag.FromErr(err)
+		}
+		if diags := waitForVMIP(ctx, d, conf); diags.HasError() {
+			return diags
+		}
+	}
+	return resourceVMRead(ctx, d, m)
+}
+
+func resourceVMDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	conf := m.(*config)
 	id := d.Id()
-	if err := deleteVM(conf, id); err != nil {
-		return err
+	if err := conf.vms().DeleteVM(ctx, id, d.Get("force_delete").(bool)); err != nil {
+		return diag.FromErr(err)
 	}
 	d.SetId("")
 	return nil
 }
+
+func expandSharedDirs(raw []interface{}) []sharedDirectory {
+	dirs := make([]sharedDirectory, 0, len(raw))
+	for _, r := range raw {
+		m := r.(map[string]interface{})
+		dirs = append(dirs, sharedDirectory{
+			Name:     m["name"].(string),
+			HostPath: m["host_path"].(string),
+			ReadOnly: m["read_only"].(bool),
+			Tag:      m["tag"].(string),
+		})
+	}
+	return dirs
+}
+
+func flattenSharedDirs(dirs []sharedDirectory) []interface{} {
+	out := make([]interface{}, 0, len(dirs))
+	for _, dir := range dirs {
+		out = append(out, map[string]interface{}{
+			"name":      dir.Name,
+			"host_path": dir.HostPath,
+			"read_only": dir.ReadOnly,
+			"tag":       dir.Tag,
+		})
+	}
+	return out
+}
+
+func expandAttachedDisks(raw []interface{}) []attachedDisk {
+	disks := make([]attachedDisk, 0, len(raw))
+	for _, r := range raw {
+		m := r.(map[string]interface{})
+		disks = append(disks, attachedDisk{
+			Name:     m["disk"].(string),
+			ReadOnly: m["read_only"].(bool),
+		})
+	}
+	return disks
+}
+
+func flattenAttachedDisks(disks []attachedDisk) []interface{} {
+	out := make([]interface{}, 0, len(disks))
+	for _, disk := range disks {
+		out = append(out, map[string]interface{}{
+			"disk":      disk.Name,
+			"read_only": disk.ReadOnly,
+		})
+	}
+	return out
+}
+
+func expandNetwork(raw []interface{}) *vmNetwork {
+	if len(raw) == 0 || raw[0] == nil {
+		return nil
+	}
+	m := raw[0].(map[string]interface{})
+	n := &vmNetwork{
+		Mode:      m["mode"].(string),
+		Interface: m["interface"].(string),
+	}
+	for _, v := range m["softnet_allow"].([]interface{}) {
+		n.SoftnetAllow = append(n.SoftnetAllow, v.(string))
+	}
+	for _, v := range m["softnet_expose"].([]interface{}) {
+		n.SoftnetExpose = append(n.SoftnetExpose, v.(string))
+	}
+	return n
+}
+
+// isDefaultNetwork reports whether n is plain nat, which is what tart run uses without a network block.
+func isDefaultNetwork(n *vmNetwork) bool {
+	return n != nil && n.Mode == "nat" && n.Interface == "" && len(n.SoftnetAllow) == 0 && len(n.SoftnetExpose) == 0
+}
+
+func flattenNetwork(n *vmNetwork) []interface{} {
+	if n == nil {
+		return nil
+	}
+	return []interface{}{map[string]interface{}{
+		"mode":           n.Mode,
+		"interface":      n.Interface,
+		"softnet_allow":  n.SoftnetAllow,
+		"softnet_expose": n.SoftnetExpose,
+	}}
+}
+
+// resourceVMNetworkDiff rejects inconsistent network blocks at plan time and
+// checks a bridged interface against the host's bridgeable interfaces.
+func resourceVMNetworkDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if !d.HasChange("network") || !d.NewValueKnown("network") {
+		return nil
+	}
+	n := expandNetwork(d.Get("network").([]interface{}))
+	if err := validateNetwork(n); err != nil {
+		return err
+	}
+	if n == nil || n.Mode != "bridged" {
+		return nil
+	}
+	if m.(*config).Mode == "local" {
+		// Local mode rejects bridged networking when the VM is created
+		return nil
+	}
+	ifaces, err := listInterfaces(ctx, m.(*config))
+	if err != nil {
+		// The controller may not be reachable during plan; it validates again on start
+		log.Printf("[WARN] could not list host interfaces: %v", err)
+		return nil
+	}
+	var names []string
+	for _, iface := range ifaces {
+		if iface.Name == n.Interface || iface.DisplayName == n.Interface {
+			return nil
+		}
+		names = append(names, iface.Name)
+	}
+	return fmt.Errorf("interface %q cannot be bridged on this host, available: %s", n.Interface, strings.Join(names, ", "))
+}
+
+// resourceVMLocalDiff rejects force_delete at plan time in local mode, which has
+// no delete protection for it to override.
+func resourceVMLocalDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if m.(*config).Mode == "local" && d.Get("force_delete").(bool) {
+		return fmt.Errorf("force_delete is not supported with mode = \"local\"; local mode has no delete protection to override")
+	}
+	return nil
+}
+
+// resourceVMImageDiff plans a replacement when replace_on_image_update is set
+// and the image tag now resolves to a different digest than the VM was built from.
+func resourceVMImageDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if d.Id() == "" || d.HasChange("image") || !d.Get("replace_on_image_update").(bool) {
+		return nil
+	}
+	image := d.Get("image").(string)
+	current := d.Get("image_digest").(string)
+	if current == "" || !isRegistryRef(image) || strings.Contains(image, "@sha256:") {
+		return nil
+	}
+	conf := m.(*config)
+	auth := credentialFor(append(expandRegistryAuth(d.Get("registry_auth").([]interface{})), conf.RegistryAuth...), image)
+	remote := remoteImageDigest(ctx, conf, image, auth)
+	if remote == "" || remote == current {
+		return nil
+	}
+	log.Printf("[INFO] %s now resolves to %s (VM built from %s), planning replacement", image, remote, current)
+	if err := d.SetNewComputed("image_digest"); err != nil {
+		return err
+	}
+	return d.ForceNew("image_digest")
+}
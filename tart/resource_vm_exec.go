@@ -0,0 +1,118 @@
+package tart
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/id"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceVMExec() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Runs a command inside a running VM through the Tart guest agent (tart exec); it runs again when triggers change",
+		CreateContext: resourceVMExecCreate,
+		ReadContext:   resourceVMExecRead,
+		UpdateContext: resourceVMExecRead,
+		DeleteContext: resourceVMExecDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+		},
+		Schema: map[string]*schema.Schema{
+			"vm_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "ID of the tart_vm to run the command in; the VM must be running",
+			},
+			"command": {
+				Type:        schema.TypeList,
+				Required:    true,
+				ForceNew:    true,
+				MinItems:    1,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Program and arguments, e.g. [\"/bin/sh\", \"-c\", \"xcode-select --install\"]",
+			},
+			"stdin": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Text piped to the command's standard input",
+			},
+			"triggers": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Arbitrary values that run the command again when they change",
+			},
+			"fail_on_error": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Fail the apply when the command exits with a non-zero status",
+			},
+			"exit_code": {Type: schema.TypeInt, Computed: true},
+			"stdout":    {Type: schema.TypeString, Computed: true},
+			"stderr":    {Type: schema.TypeString, Computed: true},
+		},
+	}
+}
+
+func resourceVMExecCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_vm_exec"); diags != nil {
+		return diags
+	}
+	vmID := d.Get("vm_id").(string)
+	var command []string
+	for _, c := range d.Get("command").([]interface{}) {
+		command = append(command, c.(string))
+	}
+	in := vmExecRequest{
+		Command:        command,
+		TimeoutSeconds: int(d.Timeout(schema.TimeoutCreate).Seconds()),
+	}
+	if v, ok := d.GetOk("stdin"); ok {
+		stdin := v.(string)
+		in.Stdin = &stdin
+	}
+	res, err := execVM(ctx, conf, vmID, in)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if res.ExitCode != 0 && d.Get("fail_on_error").(bool) {
+		return diag.Errorf("%s exited with status %d: %s", strings.Join(command, " "), res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+	d.SetId(id.UniqueId())
+	d.Set("exit_code", res.ExitCode)
+	d.Set("stdout", res.Stdout)
+	d.Set("stderr", res.Stderr)
+	return nil
+}
+
+// resourceVMExecRead only checks that the VM still exists; a replaced VM runs the command again.
+func resourceVMExecRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_vm_exec"); diags != nil {
+		return diags
+	}
+	vmID := d.Get("vm_id").(string)
+	_, err := getVM(ctx, conf, vmID)
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return apiErrorDiag(err, "reading VM "+vmID)
+	}
+	return nil
+}
+
+// resourceVMExecDelete only forgets the run; there is nothing to undo in the guest.
+func resourceVMExecDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,60 @@
+package tart
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestResourceVMExecCreate(t *testing.T) {
+	var got vmExecRequest
+	exitCode := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/vms/vm-1/exec" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(vmExecResponse{ExitCode: exitCode, Stdout: "mini-01\n", Stderr: "warning\n"})
+	}))
+	defer srv.Close()
+	conf := &config{ApiURL: srv.URL}
+
+	d := schema.TestResourceDataRaw(t, resourceVMExec().Schema, map[string]interface{}{
+		"vm_id":   "vm-1",
+		"command": []interface{}{"scutil", "--get", "LocalHostName"},
+		"stdin":   "",
+	})
+	if diags := resourceVMExecCreate(context.Background(), d, conf); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if d.Id() == "" || d.Get("stdout").(string) != "mini-01\n" || d.Get("exit_code").(int) != 0 {
+		t.Fatalf("unexpected state: id=%q stdout=%q", d.Id(), d.Get("stdout"))
+	}
+	if len(got.Command) != 3 || got.Stdin != nil || got.TimeoutSeconds <= 0 {
+		t.Fatalf("unexpected request %+v", got)
+	}
+
+	exitCode = 2
+	d = schema.TestResourceDataRaw(t, resourceVMExec().Schema, map[string]interface{}{
+		"vm_id":   "vm-1",
+		"command": []interface{}{"false"},
+	})
+	diags := resourceVMExecCreate(context.Background(), d, conf)
+	if !diags.HasError() || !strings.Contains(diags[0].Summary, "status 2") || d.Id() != "" {
+		t.Fatalf("expected a failure for a non-zero exit, got %v", diags)
+	}
+	d = schema.TestResourceDataRaw(t, resourceVMExec().Schema, map[string]interface{}{
+		"vm_id":         "vm-1",
+		"command":       []interface{}{"false"},
+		"fail_on_error": false,
+	})
+	if diags := resourceVMExecCreate(context.Background(), d, conf); diags.HasError() || d.Get("exit_code").(int) != 2 {
+		t.Fatalf("expected exit code 2 in state, got %v (%v)", d.Get("exit_code"), diags)
+	}
+}
@@ -0,0 +1,184 @@
+package tart
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func resourceVMFile() *schema.Resource {
+	return &schema.Resource{
+		Description:   "A file placed into a running VM through the Tart guest agent; it is uploaded again when its content hash changes",
+		CreateContext: resourceVMFileCreate,
+		ReadContext:   resourceVMFileRead,
+		UpdateContext: resourceVMFileCreate,
+		DeleteContext: resourceVMFileDelete,
+		Schema: map[string]*schema.Schema{
+			"vm_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "ID of the tart_vm to place the file in; the VM must be running",
+			},
+			"destination": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+				ValidateFunc: func(v interface{}, k string) ([]string, []error) {
+					if p := v.(string); !path.IsAbs(p) || path.Clean(p) != p {
+						return nil, []error{fmt.Errorf("%q must be an absolute, clean guest path, got %q", k, p)}
+					}
+					return nil, nil
+				},
+				Description: "Absolute path in the guest; parent directories are created",
+			},
+			"content": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Sensitive:    true,
+				ExactlyOneOf: []string{"content", "source"},
+				Description:  "File content",
+			},
+			"source": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Local file to upload instead of content",
+			},
+			"mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "0644",
+				ValidateFunc: validation.StringMatch(regexp.MustCompile(`^0[0-7]{3}$`), "must be a four digit octal mode such as 0644"),
+				Description:  "File mode in the guest",
+			},
+			"sha256": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "SHA-256 of the file; a change in the local content or in the guest triggers an upload",
+			},
+		},
+		CustomizeDiff: resourceVMFileDiff,
+	}
+}
+
+// resourceVMFileDiff hashes the local content so edits to a source file show up in the plan.
+func resourceVMFileDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if !d.NewValueKnown("content") || !d.NewValueKnown("source") {
+		return nil
+	}
+	sum, err := localFileSHA256(d.Get("content").(string), d.Get("source").(string))
+	if err != nil {
+		return err
+	}
+	if sum != d.Get("sha256").(string) {
+		return d.SetNew("sha256", sum)
+	}
+	return nil
+}
+
+func localFileSHA256(content, source string) (string, error) {
+	h := sha256.New()
+	if source == "" {
+		io.WriteString(h, content)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("reading %s: %w", source, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func resourceVMFileCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_vm_file"); diags != nil {
+		return diags
+	}
+	vmID := d.Get("vm_id").(string)
+	dest := d.Get("destination").(string)
+	var body io.Reader = strings.NewReader(d.Get("content").(string))
+	if source := d.Get("source").(string); source != "" {
+		f, err := os.Open(source)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		defer f.Close()
+		body = f
+	}
+	file, err := uploadVMFile(ctx, conf, vmID, dest, d.Get("mode").(string), body)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(vmID + ":" + dest)
+	d.Set("sha256", file.SHA256)
+	return nil
+}
+
+func resourceVMFileRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_vm_file"); diags != nil {
+		return diags
+	}
+	vmID := d.Get("vm_id").(string)
+	dest := d.Get("destination").(string)
+	file, err := getVMFile(ctx, conf, vmID, dest)
+	if isNotFound(err) {
+		// The file or the whole VM is gone; upload again
+		d.SetId("")
+		return nil
+	}
+	if apiStatus(err) == http.StatusConflict {
+		// A stopped VM cannot be inspected; assume the file is unchanged
+		log.Printf("[INFO] VM %s is not running, keeping %s as is", vmID, dest)
+		return nil
+	}
+	if err != nil {
+		return apiErrorDiag(err, "reading "+dest+" in VM "+vmID)
+	}
+	d.Set("sha256", file.SHA256)
+	d.Set("mode", file.Mode)
+	return nil
+}
+
+func resourceVMFileDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	conf := m.(*config)
+	if diags := conf.requireAPI("tart_vm_file"); diags != nil {
+		return diags
+	}
+	vmID := d.Get("vm_id").(string)
+	dest := d.Get("destination").(string)
+	err := deleteVMFile(ctx, conf, vmID, dest)
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if apiStatus(err) == http.StatusConflict {
+		d.SetId("")
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "File left in stopped VM",
+			Detail:   fmt.Sprintf("VM %s is not running, so %s could not be removed from it.", vmID, dest),
+		}}
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,83 @@
+package tart
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceVMFileDiff_SourceChanged(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "license.txt")
+	if err := os.WriteFile(source, []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v1, _ := localFileSHA256("", source)
+	state := &terraform.InstanceState{
+		ID: "vm-1:/etc/license.txt",
+		Attributes: map[string]string{
+			"vm_id":       "vm-1",
+			"destination": "/etc/license.txt",
+			"source":      source,
+			"mode":        "0644",
+			"sha256":      v1,
+		},
+	}
+	cfg := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"vm_id":       "vm-1",
+		"destination": "/etc/license.txt",
+		"source":      source,
+	})
+	diff, err := resourceVMFile().Diff(context.Background(), state, cfg, &config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff != nil && !diff.Empty() {
+		t.Fatalf("expected no diff for an unchanged file, got %v", diff)
+	}
+
+	if err := os.WriteFile(source, []byte("v2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	diff, err = resourceVMFile().Diff(context.Background(), state, cfg, &config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	v2, _ := localFileSHA256("", source)
+	if diff == nil || diff.Attributes["sha256"] == nil || diff.Attributes["sha256"].New != v2 || diff.RequiresNew() {
+		t.Fatalf("expected an in-place sha256 change to %s, got %v", v2, diff)
+	}
+}
+
+func TestResourceVMFileCreate_Content(t *testing.T) {
+	var body, query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body, query = string(b), r.URL.RawQuery
+		json.NewEncoder(w).Encode(guestFile{Path: "/etc/app.conf", SHA256: "abc"})
+	}))
+	defer srv.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceVMFile().Schema, map[string]interface{}{
+		"vm_id":       "vm-1",
+		"destination": "/etc/app.conf",
+		"content":     "key = value\n",
+		"mode":        "0600",
+	})
+	if diags := resourceVMFileCreate(context.Background(), d, &config{ApiURL: srv.URL}); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if body != "key = value\n" || query != "mode=0600&path=%2Fetc%2Fapp.conf" {
+		t.Fatalf("unexpected upload %q ?%s", body, query)
+	}
+	if d.Id() != "vm-1:/etc/app.conf" || d.Get("sha256").(string) != "abc" {
+		t.Fatalf("unexpected state id=%q sha256=%q", d.Id(), d.Get("sha256"))
+	}
+}
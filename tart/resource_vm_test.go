@@ -0,0 +1,102 @@
+package tart
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// A tag that moved to a new digest plans a replacement only when replace_on_image_update is set.
+func TestResourceVMImageDiff_ReplaceOnNewDigest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("remote") != "true" {
+			t.Errorf("expected a remote digest lookup, got %s", r.URL)
+		}
+		_, _ = w.Write([]byte(`{"id":"ghcr.io/acme/ubuntu:latest","digest":"sha256:old","remote_digest":"sha256:new"}`))
+	}))
+	defer srv.Close()
+	conf := &config{ApiURL: srv.URL}
+
+	plan := func(replace bool) *terraform.InstanceDiff {
+		state := &terraform.InstanceState{
+			ID: "vm-1",
+			Attributes: map[string]string{
+				"id":                      "vm-1",
+				"name":                    "web-01",
+				"image":                   "ghcr.io/acme/ubuntu:latest",
+				"image_digest":            "sha256:old",
+				"replace_on_image_update": "false",
+				"wait_for_ip":             "false",
+				"wait_for_ip_timeout":     "5m",
+				"generate_ssh_key":        "false",
+			},
+		}
+		if replace {
+			state.Attributes["replace_on_image_update"] = "true"
+		}
+		cfg := terraform.NewResourceConfigRaw(map[string]interface{}{
+			"name":                    "web-01",
+			"image":                   "ghcr.io/acme/ubuntu:latest",
+			"replace_on_image_update": replace,
+		})
+		diff, err := resourceVM().Diff(context.Background(), state, cfg, conf)
+		if err != nil {
+			t.Fatalf("diff failed: %v", err)
+		}
+		return diff
+	}
+
+	if diff := plan(true); diff == nil || !diff.RequiresNew() {
+		t.Fatalf("expected a replacement when the tag moved, got %#v", diff)
+	}
+	if diff := plan(false); diff != nil && diff.RequiresNew() {
+		t.Fatalf("expected no replacement without replace_on_image_update, got %#v", diff)
+	}
+}
+
+// tart set only applies to a stopped VM, so a hardware change on a running VM is wrapped in a stop and start.
+func TestResourceVMUpdate_RestartsForHardware(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			calls = append(calls, r.Method+" "+r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"id":"vm-1","name":"web-01","image":"base","status":"running","cpu":4}`))
+	}))
+	defer srv.Close()
+	conf := &config{ApiURL: srv.URL}
+
+	state := &terraform.InstanceState{
+		ID: "vm-1",
+		Attributes: map[string]string{
+			"id":                  "vm-1",
+			"name":                "web-01",
+			"image":               "base",
+			"state":               "running",
+			"cpu":                 "2",
+			"wait_for_ip":         "false",
+			"wait_for_ip_timeout": "5m",
+			"generate_ssh_key":    "false",
+		},
+	}
+	cfg := terraform.NewResourceConfigRaw(map[string]interface{}{"name": "web-01", "image": "base", "state": "running", "cpu": 4})
+	diff, err := resourceVM().Diff(context.Background(), state, cfg, conf)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	d, err := schema.InternalMap(resourceVM().Schema).Data(state, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diags := resourceVMUpdate(context.Background(), d, conf); diags.HasError() {
+		t.Fatalf("update failed: %v", diags)
+	}
+	if got := strings.Join(calls, ", "); got != "POST /vms/vm-1/stop, PATCH /vms/vm-1, POST /vms/vm-1/run" {
+		t.Fatalf("expected stop, set and start, got %s", got)
+	}
+}
@@ -0,0 +1,69 @@
+package tart
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sharedDirectory is a host directory exposed to the guest with `tart run --dir`.
+type sharedDirectory struct {
+	Name     string `json:"name"`
+	HostPath string `json:"host_path"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+}
+
+// sharedDirAllowlist returns the host directories VMs may mount, taken from
+// TART_SHARED_DIR_ALLOWLIST (a PATH-style list). An empty list allows none.
+func sharedDirAllowlist() []string {
+	var roots []string
+	for _, p := range filepath.SplitList(os.Getenv("TART_SHARED_DIR_ALLOWLIST")) {
+		if p != "" {
+			roots = append(roots, filepath.Clean(p))
+		}
+	}
+	return roots
+}
+
+// sharedDirNotAllowedError marks host paths outside the allowlist, as opposed to malformed requests.
+type sharedDirNotAllowedError struct{ path string }
+
+func (e sharedDirNotAllowedError) Error() string {
+	return fmt.Sprintf("host_path %q is not in the shared directory allowlist", e.path)
+}
+
+// validateSharedDirs checks names are usable and unique and that every host
+// path sits at or below an allowlisted root.
+func validateSharedDirs(dirs []sharedDirectory, allowlist []string) error {
+	seen := map[string]bool{}
+	for _, d := range dirs {
+		if d.Name == "" || strings.ContainsAny(d.Name, ":,") {
+			return fmt.Errorf("invalid shared directory name %q", d.Name)
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("duplicate shared directory name %q", d.Name)
+		}
+		seen[d.Name] = true
+		if !filepath.IsAbs(d.HostPath) || strings.ContainsAny(d.HostPath, ":,") {
+			return fmt.Errorf("host_path %q must be an absolute path without ':' or ','", d.HostPath)
+		}
+		if strings.ContainsAny(d.Tag, ":,") {
+			return fmt.Errorf("invalid tag %q", d.Tag)
+		}
+		if !pathAllowed(filepath.Clean(d.HostPath), allowlist) {
+			return sharedDirNotAllowedError{d.HostPath}
+		}
+	}
+	return nil
+}
+
+func pathAllowed(p string, allowlist []string) bool {
+	for _, root := range allowlist {
+		if p == root || strings.HasPrefix(p, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package tart
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateSharedDirs(t *testing.T) {
+	allow := []string{"/Volumes/cache", "/Users/ci/"}
+	ok := []sharedDirectory{
+		{Name: "cache", HostPath: "/Volumes/cache"},
+		{Name: "src", HostPath: "/Users/ci/src/project", ReadOnly: true, Tag: "build"},
+	}
+	if err := validateSharedDirs(ok, allow); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var denied sharedDirNotAllowedError
+	for _, p := range []string{"/Volumes/cache-other", "/Users/ci/../admin", "/etc"} {
+		err := validateSharedDirs([]sharedDirectory{{Name: "x", HostPath: p}}, allow)
+		if !errors.As(err, &denied) {
+			t.Errorf("%s: expected allowlist error, got %v", p, err)
+		}
+	}
+	if err := validateSharedDirs(ok, nil); !errors.As(err, &denied) {
+		t.Errorf("expected an empty allowlist to deny everything, got %v", err)
+	}
+
+	invalid := [][]sharedDirectory{
+		{{Name: "", HostPath: "/Volumes/cache"}},
+		{{Name: "a", HostPath: "relative/path"}},
+		{{Name: "a", HostPath: "/Volumes/cache:ro"}},
+		{{Name: "a", HostPath: "/Volumes/cache", Tag: "x,y"}},
+		{{Name: "a", HostPath: "/Volumes/cache"}, {Name: "a", HostPath: "/Users/ci"}},
+	}
+	for _, dirs := range invalid {
+		err := validateSharedDirs(dirs, allow)
+		if err == nil || errors.As(err, &denied) {
+			t.Errorf("%+v: expected a validation error, got %v", dirs, err)
+		}
+	}
+}
+
+// Shares outside the allowlist are refused; allowed ones reach tart run on start.
+func TestHandleVMs_SharedDirectories(t *testing.T) {
+	t.Setenv("TART_SHARED_DIR_ALLOWLIST", "/Volumes/cache")
+	var runData json.RawMessage
+	startExecutorFunc(t, func(action string, data json.RawMessage) string {
+		if action == "run_vm" {
+			runData = data
+		}
+		return ""
+	})
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+
+	post := func(dirs []sharedDirectory) int {
+		body, _ := json.Marshal(map[string]interface{}{"name": "share-vm", "image": "base", "shared_directories": dirs})
+		resp, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post([]sharedDirectory{{Name: "etc", HostPath: "/etc"}}); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a path outside the allowlist, got %d", code)
+	}
+	if code := post([]sharedDirectory{{Name: "cache", HostPath: "/Volumes/cache", ReadOnly: true}}); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+
+	resp, err := http.Post(srv.URL+"/api/vms/share-vm/run", "application/json", bytes.NewReader([]byte(`{"detach":true}`)))
+	if err != nil {
+		t.Fatalf("run request failed: %v", err)
+	}
+	resp.Body.Close()
+	var got struct {
+		Dirs      []sharedDirectory `json:"dirs"`
+		Allowlist []string          `json:"allowlist"`
+	}
+	_ = json.Unmarshal(runData, &got)
+	if len(got.Dirs) != 1 || got.Dirs[0].HostPath != "/Volumes/cache" || !got.Dirs[0].ReadOnly {
+		t.Fatalf("expected the share in run_vm, got %s", runData)
+	}
+	if len(got.Allowlist) != 1 || got.Allowlist[0] != "/Volumes/cache" {
+		t.Fatalf("expected the allowlist in run_vm for the executor's check, got %s", runData)
+	}
+
+	// PATCH replaces the shares and is validated the same way
+	req, _ := http.NewRequest(http.MethodPatch, srv.URL+"/api/vms/share-vm", bytes.NewReader([]byte(`{"shared_directories":[{"name":"tmp","host_path":"/tmp"}]}`)))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("patch request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 from PATCH, got %d", resp.StatusCode)
+	}
+}
+
+// The executor resolves symlinks and may still refuse a share; that is a 403, not an executor failure.
+func TestHandleVMPower_SharedDirDeniedByExecutor(t *testing.T) {
+	t.Setenv("TART_SHARED_DIR_ALLOWLIST", "/Volumes/cache")
+	startFakeExecutor(t)
+	srv := httptest.NewServer(SetupRouter())
+	defer srv.Close()
+	body, _ := json.Marshal(map[string]interface{}{"name": "link-vm", "image": "base", "shared_directories": []sharedDirectory{{Name: "c", HostPath: "/Volumes/cache/link"}}})
+	resp, err := http.Post(srv.URL+"/api/vms", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	serveExecutor(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `host_path "/Volumes/cache/link" is not in the shared directory allowlist`, http.StatusForbidden)
+	}))
+	resp, err = http.Post(srv.URL+"/api/vms/link-vm/run", "application/json", nil)
+	if err != nil {
+		t.Fatalf("run request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,32 @@
+package tart
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// generateSSHKeyPair creates an ed25519 keypair and returns the public key as
+// an authorized_keys line and the private key in OpenSSH PEM format.
+func generateSSHKeyPair(comment string) (string, string, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return "", "", err
+	}
+	authorized := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(sshPub)), "\n")
+	if comment != "" {
+		authorized += " " + comment
+	}
+	block, err := ssh.MarshalPrivateKey(priv, comment)
+	if err != nil {
+		return "", "", err
+	}
+	return authorized, string(pem.EncodeToMemory(block)), nil
+}
@@ -0,0 +1,77 @@
+package tart
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// transportOptions are the provider settings that shape the controller HTTP client.
+type transportOptions struct {
+	CABundle           string // path to a PEM file, usually from a credentials profile
+	CACertPEM          string
+	ClientCertPEM      string
+	ClientKeyPEM       string
+	InsecureSkipVerify bool
+	RequestTimeout     time.Duration
+}
+
+// newHTTPClient builds the client used to talk to the controller. Extra CAs are
+// trusted in addition to the system pool; a client certificate enables mTLS.
+func newHTTPClient(opts transportOptions) (*http.Client, error) {
+	tlsConf := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CABundle != "" || opts.CACertPEM != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if opts.CABundle != "" {
+			pem, err := os.ReadFile(opts.CABundle)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.New("no certificates found in CA bundle " + opts.CABundle)
+			}
+		}
+		if opts.CACertPEM != "" && !pool.AppendCertsFromPEM([]byte(opts.CACertPEM)) {
+			return nil, errors.New("no certificates found in ca_cert_pem")
+		}
+		tlsConf.RootCAs = pool
+	}
+	if (opts.ClientCertPEM == "") != (opts.ClientKeyPEM == "") {
+		return nil, errors.New("client_cert_pem and client_key_pem must be set together")
+	}
+	if opts.ClientCertPEM != "" {
+		cert, err := tls.X509KeyPair([]byte(opts.ClientCertPEM), []byte(opts.ClientKeyPEM))
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConf
+	return &http.Client{Transport: transport, Timeout: opts.RequestTimeout}, nil
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
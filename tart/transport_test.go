@@ -0,0 +1,131 @@
+package tart
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	cases := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"7", 7 * time.Second, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{"soon", 0, false},
+	}
+	for _, tc := range cases {
+		resp := &http.Response{Header: http.Header{}}
+		if tc.header != "" {
+			resp.Header.Set("Retry-After", tc.header)
+		}
+		got, ok := retryAfter(resp, now)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("Retry-After %q: got %s/%v, want %s/%v", tc.header, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestDoRequest_HonorsRetryAfterOn429(t *testing.T) {
+	var calls int32
+	var first time.Time
+	var waited time.Duration
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		waited = time.Since(first)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	conf := &config{ApiURL: srv.URL, MaxRetries: 1, RetryBackoff: time.Millisecond}
+	if _, err := listVMs(context.Background(), conf); err != nil {
+		t.Fatalf("expected success after retry, got %v", err)
+	}
+	if waited < time.Second {
+		t.Fatalf("expected to wait for Retry-After (1s), waited %s", waited)
+	}
+}
+
+// selfSignedPEM returns a PEM certificate and key usable for both server and client auth.
+func selfSignedPEM(t *testing.T, cn string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestNewHTTPClient_CustomCAAndClientCert(t *testing.T) {
+	clientCert, clientKey := selfSignedPEM(t, "terraform")
+	clientPool := x509.NewCertPool()
+	clientPool.AppendCertsFromPEM([]byte(clientCert))
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientPool}
+	srv.StartTLS()
+	defer srv.Close()
+	serverCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	client, err := newHTTPClient(transportOptions{CACertPEM: serverCA, ClientCertPEM: clientCert, ClientKeyPEM: clientKey})
+	if err != nil {
+		t.Fatalf("newHTTPClient failed: %v", err)
+	}
+	if _, err := listVMs(context.Background(), &config{ApiURL: srv.URL, HTTPClient: client}); err != nil {
+		t.Fatalf("expected mTLS request to succeed, got %v", err)
+	}
+
+	// Without the client certificate the server must refuse the handshake
+	noCert, _ := newHTTPClient(transportOptions{CACertPEM: serverCA})
+	if _, err := listVMs(context.Background(), &config{ApiURL: srv.URL, HTTPClient: noCert}); err == nil {
+		t.Fatalf("expected request without client certificate to fail")
+	}
+}
+
+func TestNewHTTPClient_RejectsHalfClientCert(t *testing.T) {
+	cert, _ := selfSignedPEM(t, "terraform")
+	if _, err := newHTTPClient(transportOptions{ClientCertPEM: cert}); err == nil {
+		t.Fatalf("expected error when client_key_pem is missing")
+	}
+}
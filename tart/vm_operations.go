@@ -1,41 +1,288 @@
 package tart
 
 import (
+    "bytes"
     "context"
+    "encoding/json"
+    "errors"
     "fmt"
+    "os"
     "os/exec"
+    "strconv"
     "strings"
+    "time"
+
+    "github.com/beleganjur/terraform-provider-tart/internal/tartlist"
 )
 
+// cliVMInfo mirrors the fields of `tart get --format json` the provider reads.
+type cliVMInfo struct {
+    CPU    int `json:"CPU"`
+    Memory int `json:"Memory"`
+    Disk   int `json:"Disk"`
+}
+
+// runTart runs a tart subcommand and returns its stdout; stderr ends up in the error.
+func runTart(ctx context.Context, env []string, args ...string) ([]byte, error) {
+    cmd := exec.CommandContext(ctx, "tart", args...)
+    if env != nil {
+        cmd.Env = append(os.Environ(), env...)
+    }
+    var stderr bytes.Buffer
+    cmd.Stderr = &stderr
+    out, err := cmd.Output()
+    if err != nil {
+        return out, fmt.Errorf("tart %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+    }
+    return out, nil
+}
+
 // cliCreateVM creates a new VM by cloning a base image using the Tart CLI.
-func cliCreateVM(ctx context.Context, baseImage, newVMName string) error {
-    cmd := exec.CommandContext(ctx, "tart", "clone", baseImage, newVMName)
-    out, err := cmd.CombinedOutput()
+// Registry credentials, when given, only live in the environment of tart clone.
+func cliCreateVM(ctx context.Context, baseImage, newVMName string, auth *registryCredential) error {
+    var env []string
+    if auth != nil {
+        env = []string{"TART_REGISTRY_USERNAME=" + auth.Username, "TART_REGISTRY_PASSWORD=" + auth.Password}
+    }
+    _, err := runTart(ctx, env, "clone", baseImage, newVMName)
+    return err
+}
+
+// cliListVMs returns the local VMs (not the OCI cache) from `tart list --format json`.
+func cliListVMs(ctx context.Context) ([]tartlist.Entry, error) {
+    out, err := runTart(ctx, nil, "list", "--source", "local", "--format", "json")
     if err != nil {
-        return fmt.Errorf("tart clone failed: %v\nOutput: %s", err, string(out))
+        return nil, err
     }
-    return nil
+    return tartlist.Parse(out)
 }
 
-// cliGetVM checks a VM's existence by listing via the Tart CLI.
-func cliGetVM(ctx context.Context, vmName string) (bool, error) {
-    cmd := exec.CommandContext(ctx, "tart", "list")
-    out, err := cmd.Output()
+// cliGetVM looks a VM up by its exact name; it returns nil if there is none.
+func cliGetVM(ctx context.Context, vmName string) (*tartlist.Entry, error) {
+    entries, err := cliListVMs(ctx)
     if err != nil {
-        return false, fmt.Errorf("tart list failed: %w", err)
+        return nil, err
+    }
+    for i := range entries {
+        if entries[i].Name == vmName && !strings.EqualFold(entries[i].Source, "oci") {
+            return &entries[i], nil
+        }
     }
-    // Output format: may need more robust parsing
-    list := string(out)
-    return strings.Contains(list, vmName), nil
+    return nil, nil
 }
 
 // cliDeleteVM deletes a VM using the Tart CLI.
 func cliDeleteVM(ctx context.Context, vmName string) error {
-    cmd := exec.CommandContext(ctx, "tart", "delete", vmName)
-    out, err := cmd.CombinedOutput()
+    _, err := runTart(ctx, nil, "delete", vmName)
+    return err
+}
+
+// cliSetVM applies hardware settings with tart set; zero values are left alone.
+func cliSetVM(ctx context.Context, vmName string, h vmHardware) error {
+    args := []string{"set", vmName}
+    if h.CPU > 0 {
+        args = append(args, "--cpu", strconv.Itoa(h.CPU))
+    }
+    if h.MemoryMB > 0 {
+        args = append(args, "--memory", strconv.Itoa(h.MemoryMB))
+    }
+    if h.DiskSizeGB > 0 {
+        args = append(args, "--disk-size", strconv.Itoa(h.DiskSizeGB))
+    }
+    if len(args) == 2 {
+        return nil
+    }
+    _, err := runTart(ctx, nil, args...)
+    return err
+}
+
+// cliRunVM starts the VM headless in the background. tart run lives as long as
+// the VM, so it is not bound to ctx and runs in its own process group: neither
+// Ctrl-C in Terraform nor Terraform stopping the provider plugin stops the VM.
+func cliRunVM(ctx context.Context, vmName string) error {
+    cmd := exec.Command("tart", "run", "--no-graphics", vmName)
+    detachProcess(cmd)
+    if err := cmd.Start(); err != nil {
+        return fmt.Errorf("tart run failed: %w", err)
+    }
+    exited := make(chan error, 1)
+    go func() { exited <- cmd.Wait() }()
+    // Wait until tart reports the VM as running, so failures surface here
+    for {
+        vm, err := cliGetVM(ctx, vmName)
+        if err != nil {
+            return err
+        }
+        if vm != nil && vm.State == "running" {
+            return nil
+        }
+        select {
+        case err := <-exited:
+            return fmt.Errorf("tart run exited before %s was running: %v", vmName, err)
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-time.After(localPollInterval):
+        }
+    }
+}
+
+// localPollInterval is how often the local backend re-checks a starting VM.
+var localPollInterval = time.Second
+
+// localBackend implements vmBackend with the tart binary on the machine running
+// Terraform. There is no controller, so VM IDs are the VM names.
+type localBackend struct{}
+
+// localUnsupported names the settings that need the controller or executor.
+func localUnsupported(in vmCreateRequest) error {
+    var fields []string
+    if in.UserData != "" || in.MetaData != "" || in.NetworkConfig != "" {
+        fields = append(fields, "cloud-init")
+    }
+    if len(in.SSHAuthorizedKeys) > 0 {
+        fields = append(fields, "ssh_authorized_keys/generate_ssh_key")
+    }
+    if len(in.SharedDirectories) > 0 {
+        fields = append(fields, "shared_directory")
+    }
+    if in.Network != nil && in.Network.Mode != "nat" {
+        fields = append(fields, "network")
+    }
+    if len(in.Disks) > 0 {
+        fields = append(fields, "attach_disk")
+    }
+    if len(fields) == 0 {
+        return nil
+    }
+    return fmt.Errorf("%s not supported with mode = \"local\"", strings.Join(fields, ", "))
+}
+
+func (localBackend) CreateVM(ctx context.Context, in vmCreateRequest) (string, string, error) {
+    if err := localUnsupported(in); err != nil {
+        return "", "", err
+    }
+    existing, err := cliGetVM(ctx, in.Name)
+    if err != nil {
+        return "", "", err
+    }
+    status := "stopped"
+    switch {
+    case existing != nil && !in.AdoptExisting:
+        return "", "", fmt.Errorf("VM %q already exists; set adopt_existing to take it over", in.Name)
+    case existing != nil:
+        status = existing.State
+    default:
+        source := in.Image
+        if in.SourceVM != "" {
+            source = in.SourceVM
+        }
+        if source == "" {
+            return "", "", errors.New("exactly one of image or source_vm is required")
+        }
+        if err := cliCreateVM(ctx, source, in.Name, in.RegistryAuth); err != nil {
+            return "", "", err
+        }
+    }
+    h := vmHardware{CPU: in.CPU, MemoryMB: in.MemoryMB, DiskSizeGB: in.DiskSizeGB}
+    if err := cliSetVM(ctx, in.Name, h); err != nil {
+        return "", "", err
+    }
+    return in.Name, status, nil
+}
+
+func (localBackend) GetVM(ctx context.Context, id string) (*vmResponse, error) {
+    vm, err := cliGetVM(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+    if vm == nil {
+        return nil, notFoundError(id)
+    }
+    out := &vmResponse{ID: vm.Name, Name: vm.Name, Status: vm.State, DiskSizeGB: vm.Disk}
+    raw, err := runTart(ctx, nil, "get", id, "--format", "json")
     if err != nil {
-        return fmt.Errorf("tart delete failed: %v\nOutput: %s", err, out)
+        return nil, err
+    }
+    var info cliVMInfo
+    if err := json.Unmarshal(raw, &info); err != nil {
+        return nil, fmt.Errorf("parse tart get output: %w", err)
+    }
+    out.CPU, out.MemoryMB = info.CPU, info.Memory
+    if info.Disk > 0 {
+        out.DiskSizeGB = info.Disk
     }
-    return nil
+    return out, nil
 }
 
+func (localBackend) UpdateVM(ctx context.Context, id string, in vmUpdateRequest) (string, error) {
+    if (in.SharedDirectories != nil && len(*in.SharedDirectories) > 0) || (in.Disks != nil && len(*in.Disks) > 0) ||
+        (in.Network != nil && in.Network.Mode != "nat") {
+        return id, errors.New("shared_directory, network and attach_disk are not supported with mode = \"local\"")
+    }
+    if in.Name != "" && in.Name != id {
+        if _, err := runTart(ctx, nil, "rename", id, in.Name); err != nil {
+            return id, err
+        }
+        id = in.Name
+    }
+    return id, cliSetVM(ctx, id, vmHardware{CPU: in.CPU, MemoryMB: in.MemoryMB, DiskSizeGB: in.DiskSizeGB})
+}
+
+// DeleteVM deletes any local VM: without a controller there are no ownership
+// records to protect it, so force is refused rather than silently ignored.
+func (b localBackend) DeleteVM(ctx context.Context, id string, force bool) error {
+    if force {
+        return errors.New("force_delete is not supported with mode = \"local\"; local mode has no delete protection to override")
+    }
+    vm, err := cliGetVM(ctx, id)
+    if err != nil {
+        return err
+    }
+    if vm == nil {
+        return nil
+    }
+    if vm.State != "stopped" {
+        if _, err := runTart(ctx, nil, "stop", id); err != nil {
+            return err
+        }
+    }
+    return cliDeleteVM(ctx, id)
+}
+
+func (localBackend) SetVMState(ctx context.Context, id, state string) error {
+    switch state {
+    case "running":
+        return cliRunVM(ctx, id)
+    case "stopped":
+        _, err := runTart(ctx, nil, "stop", id)
+        return err
+    case "suspended":
+        _, err := runTart(ctx, nil, "suspend", id)
+        return err
+    }
+    return fmt.Errorf("unsupported state %q", state)
+}
+
+func (localBackend) GetVMIP(ctx context.Context, id string, wait time.Duration) (*vmIPResponse, error) {
+    args := []string{"ip", id}
+    if secs := int(wait.Seconds()); secs > 0 {
+        args = append(args, "--wait", strconv.Itoa(secs))
+    }
+    out, err := runTart(ctx, nil, args...)
+    if err != nil {
+        return nil, err
+    }
+    return &vmIPResponse{IPAddress: strings.TrimSpace(string(out))}, nil
+}
+
+func (localBackend) ListVMs(ctx context.Context) ([]vmResponse, error) {
+    entries, err := cliListVMs(ctx)
+    if err != nil {
+        return nil, err
+    }
+    vms := make([]vmResponse, 0, len(entries))
+    for _, e := range entries {
+        vms = append(vms, vmResponse{ID: e.Name, Name: e.Name, Status: e.State, DiskSizeGB: e.Disk})
+    }
+    return vms, nil
+}
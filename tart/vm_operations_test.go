@@ -0,0 +1,221 @@
+package tart
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// fakeTartCLI puts a tart script on PATH that keeps VMs as files in a temp dir:
+// <name> holds the state, <name>.log the commands run against it.
+func fakeTartCLI(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	state := filepath.Join(dir, "vms")
+	if err := os.Mkdir(state, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	script := `#!/bin/sh
+state="` + state + `"
+cmd="$1"; shift
+case "$cmd" in
+clone)
+  [ -e "$state/$2" ] && { echo "VM $2 already exists" >&2; exit 1; }
+  echo stopped > "$state/$2"
+  echo "clone $1 user=$TART_REGISTRY_USERNAME" >> "$state/$2.log" ;;
+list)
+  printf '['; sep=''
+  for f in "$state"/*; do
+    case "$f" in *.log) continue ;; esac
+    [ -e "$f" ] || continue
+    printf '%s{"Source":"local","Name":"%s","Disk":50,"State":"%s"}' "$sep" "$(basename "$f")" "$(cat "$f")"
+    sep=','
+  done
+  echo ']' ;;
+get)
+  [ -e "$state/$1" ] || { echo "VM $1 does not exist" >&2; exit 1; }
+  echo '{"CPU":4,"Memory":8192,"Disk":60}' ;;
+set)
+  echo "set $*" >> "$state/$1.log" ;;
+rename)
+  mv "$state/$1" "$state/$2"; mv "$state/$1.log" "$state/$2.log" ;;
+run)
+  echo running > "$state/$2"
+  exec sleep 2 ;;
+stop)
+  echo stopped > "$state/$1" ;;
+delete)
+  rm -f "$state/$1" "$state/$1.log" ;;
+ip)
+  echo 192.168.64.7 ;;
+*)
+  echo "unexpected tart $cmd" >&2; exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "tart"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return state
+}
+
+func readVMLog(t *testing.T, state, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(state, name+".log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCLIGetVM_ExactName(t *testing.T) {
+	state := fakeTartCLI(t)
+	os.WriteFile(filepath.Join(state, "web-2"), []byte("running\n"), 0o644)
+
+	ctx := context.Background()
+	vm, err := cliGetVM(ctx, "web")
+	if err != nil {
+		t.Fatalf("cliGetVM failed: %v", err)
+	}
+	if vm != nil {
+		t.Fatalf("web must not match web-2, got %+v", vm)
+	}
+	vm, err = cliGetVM(ctx, "web-2")
+	if err != nil || vm == nil || vm.State != "running" || vm.Disk != 50 {
+		t.Fatalf("unexpected lookup of web-2: %+v, %v", vm, err)
+	}
+}
+
+func TestLocalBackend_Lifecycle(t *testing.T) {
+	state := fakeTartCLI(t)
+	localPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { localPollInterval = time.Second })
+
+	ctx := context.Background()
+	b := localBackend{}
+	id, status, err := b.CreateVM(ctx, vmCreateRequest{
+		Name:         "web",
+		Image:        "ghcr.io/acme/base:latest",
+		CPU:          4,
+		RegistryAuth: &registryCredential{Host: "ghcr.io", Username: "bot", Password: "secret"},
+	})
+	if err != nil {
+		t.Fatalf("CreateVM failed: %v", err)
+	}
+	if id != "web" || status != "stopped" {
+		t.Fatalf("unexpected id %q status %q", id, status)
+	}
+	if log := readVMLog(t, state, "web"); !strings.Contains(log, "clone ghcr.io/acme/base:latest user=bot") || !strings.Contains(log, "set web --cpu 4") {
+		t.Fatalf("unexpected tart calls:\n%s", log)
+	}
+
+	if _, _, err := b.CreateVM(ctx, vmCreateRequest{Name: "web", Image: "ghcr.io/acme/base:latest"}); err == nil || !strings.Contains(err.Error(), "adopt_existing") {
+		t.Fatalf("expected existing VM to be refused, got %v", err)
+	}
+	if _, _, err := b.CreateVM(ctx, vmCreateRequest{Name: "web", AdoptExisting: true}); err != nil {
+		t.Fatalf("adopting failed: %v", err)
+	}
+	if _, _, err := b.CreateVM(ctx, vmCreateRequest{Name: "db", Image: "base", SharedDirectories: []sharedDirectory{{Name: "src", HostPath: "/src"}}}); err == nil || !strings.Contains(err.Error(), "shared_directory") {
+		t.Fatalf("expected shared directories to be rejected, got %v", err)
+	}
+
+	if err := b.SetVMState(ctx, "web", "running"); err != nil {
+		t.Fatalf("SetVMState failed: %v", err)
+	}
+	vm, err := b.GetVM(ctx, "web")
+	if err != nil {
+		t.Fatalf("GetVM failed: %v", err)
+	}
+	if vm.Status != "running" || vm.CPU != 4 || vm.MemoryMB != 8192 || vm.DiskSizeGB != 60 {
+		t.Fatalf("unexpected VM %+v", vm)
+	}
+	ip, err := b.GetVMIP(ctx, "web", 0)
+	if err != nil || ip.IPAddress != "192.168.64.7" {
+		t.Fatalf("unexpected IP %+v, %v", ip, err)
+	}
+
+	id, err = b.UpdateVM(ctx, "web", vmUpdateRequest{Name: "web-renamed"})
+	if err != nil || id != "web-renamed" {
+		t.Fatalf("rename returned %q, %v", id, err)
+	}
+	if err := b.DeleteVM(ctx, id, true); err == nil || !strings.Contains(err.Error(), "force_delete") {
+		t.Fatalf("expected force_delete to be refused in local mode, got %v", err)
+	}
+	if err := b.DeleteVM(ctx, id, false); err != nil {
+		t.Fatalf("DeleteVM failed: %v", err)
+	}
+	if _, err := b.GetVM(ctx, id); !isNotFound(err) {
+		t.Fatalf("expected not found after delete, got %v", err)
+	}
+}
+
+func TestConfigureProvider_LocalMode(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{"mode": "local"})
+	meta, err := configureProvider(d)
+	if err != nil {
+		t.Fatalf("configureProvider failed: %v", err)
+	}
+	conf := meta.(*config)
+	if _, ok := conf.vms().(localBackend); !ok {
+		t.Fatalf("expected the local backend, got %T", conf.vms())
+	}
+	if diags := conf.requireAPI("tart_disk"); !diags.HasError() {
+		t.Fatalf("expected tart_disk to be refused in local mode")
+	}
+}
+
+// Resources served only by the controller fail with a clear error in local mode
+// on every operation, not just create.
+func TestLocalMode_APIOnlyResourcesRefused(t *testing.T) {
+	conf := &config{Mode: "local", Backend: localBackend{}}
+	ctx := context.Background()
+	cases := map[string]func() diag.Diagnostics{
+		"tart_image read": func() diag.Diagnostics {
+			d := schema.TestResourceDataRaw(t, resourceImage().Schema, map[string]interface{}{"ref": "ghcr.io/acme/base:latest"})
+			d.SetId("ghcr.io/acme/base:latest")
+			return resourceImageRead(ctx, d, conf)
+		},
+		"tart_image delete": func() diag.Diagnostics {
+			d := schema.TestResourceDataRaw(t, resourceImage().Schema, map[string]interface{}{"ref": "ghcr.io/acme/base:latest"})
+			d.SetId("ghcr.io/acme/base:latest")
+			return resourceImageDelete(ctx, d, conf)
+		},
+		"tart_disk read": func() diag.Diagnostics {
+			d := schema.TestResourceDataRaw(t, resourceDisk().Schema, map[string]interface{}{"name": "data", "size_gb": 10})
+			d.SetId("data")
+			return resourceDiskRead(ctx, d, conf)
+		},
+		"tart_disk delete": func() diag.Diagnostics {
+			d := schema.TestResourceDataRaw(t, resourceDisk().Schema, map[string]interface{}{"name": "data", "size_gb": 10})
+			d.SetId("data")
+			return resourceDiskDelete(ctx, d, conf)
+		},
+		"tart_vm_file read": func() diag.Diagnostics {
+			d := schema.TestResourceDataRaw(t, resourceVMFile().Schema, map[string]interface{}{"vm_id": "vm-1", "destination": "/etc/app.conf", "content": "x"})
+			d.SetId("vm-1:/etc/app.conf")
+			return resourceVMFileRead(ctx, d, conf)
+		},
+		"tart_vm_file delete": func() diag.Diagnostics {
+			d := schema.TestResourceDataRaw(t, resourceVMFile().Schema, map[string]interface{}{"vm_id": "vm-1", "destination": "/etc/app.conf", "content": "x"})
+			d.SetId("vm-1:/etc/app.conf")
+			return resourceVMFileDelete(ctx, d, conf)
+		},
+		"tart_vm_exec read": func() diag.Diagnostics {
+			d := schema.TestResourceDataRaw(t, resourceVMExec().Schema, map[string]interface{}{"vm_id": "vm-1", "command": []interface{}{"true"}})
+			d.SetId("exec-1")
+			return resourceVMExecRead(ctx, d, conf)
+		},
+	}
+	for name, op := range cases {
+		diags := op()
+		if !diags.HasError() || !strings.Contains(diags[0].Summary, "mode = \"local\"") {
+			t.Errorf("%s: expected the local mode error, got %v", name, diags)
+		}
+	}
+}